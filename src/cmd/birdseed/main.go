@@ -0,0 +1,16 @@
+// Command birdseed seeds csv stock data into a database, see the README for its options
+package main
+
+import (
+	"fmt"
+	"os"
+
+	birdseed "github.com/jonaskarlssondev/BirdSeed"
+)
+
+func main() {
+	if err := birdseed.Run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+}
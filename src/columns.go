@@ -0,0 +1,115 @@
+package birdseed
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// columnIndex maps the fields of a candle, 'ticker', 'date', 'open', 'high', 'low', 'close',
+// 'adj_close' and 'volume', to the index of the column holding them in a row
+type columnIndex map[string]int
+
+// positionalColumns is the layout of files without a header row: Date,Open,High,Low,Close,Adj Close,Volume.
+// Universe dumps hold the ticker in place of the date.
+var positionalColumns = columnIndex{"ticker": 0, "date": 0, "open": 1, "high": 2, "low": 3, "close": 4, "adj_close": 5, "volume": 6}
+
+// positionalLayout returns the positional layout of rows with n columns. Rows of five columns
+// hold Date,Open,High,Low,Close and rows of six add the Volume, rows of seven or more follow
+// positionalColumns.
+func positionalLayout(n int) columnIndex {
+	switch {
+	case n >= 7:
+		return positionalColumns
+	case n == 6:
+		return columnIndex{"ticker": 0, "date": 0, "open": 1, "high": 2, "low": 3, "close": 4, "volume": 5}
+	default:
+		return columnIndex{"ticker": 0, "date": 0, "open": 1, "high": 2, "low": 3, "close": 4}
+	}
+}
+
+// headerNames maps the lower cased column names recognized in a header row to the field they hold.
+// 'Adj Close' is its own field, so it is never mistaken for the close.
+var headerNames = map[string]string{
+	"ticker":     "ticker",
+	"symbol":     "ticker",
+	"date":       "date",
+	"datetime":   "date",
+	"timestamp":  "date",
+	"time":       "date",
+	"open":       "open",
+	"high":       "high",
+	"low":        "low",
+	"close":      "close",
+	"close/last": "close",
+	"last":       "close",
+	"adj close":  "adj_close",
+	"adj_close":  "adj_close",
+	"adjclose":   "adj_close",
+	"volume":     "volume",
+	"vol":        "volume",
+}
+
+// requiredColumns returns the fields every row has to hold. Universe dumps take the date from
+// the filename and the ticker from a column, other files the other way around. The volume is
+// not required, as some sources such as indices have none.
+func requiredColumns(cfg config) []string {
+	if cfg.universe {
+		return []string{"ticker", "open", "high", "low", "close"}
+	}
+
+	return []string{"date", "open", "high", "low", "close"}
+}
+
+// headerColumns locates the columns of the named file by the names in its header row, so the
+// columns may come in any order. A header without a single known name is taken to be a plain
+// header over the positional layout.
+func headerColumns(s string, header []string, cfg config) (columnIndex, error) {
+	cols := columnIndex{}
+	for i, h := range header {
+		name := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		if field, ok := headerNames[name]; ok {
+			if _, seen := cols[field]; !seen {
+				cols[field] = i
+			}
+		}
+	}
+
+	if len(cols) == 0 {
+		slog.Warn("No known column names in the header. Reading the columns by position.", "file", s)
+		return positionalLayout(len(header)), nil
+	}
+
+	missing := []string{}
+	for _, field := range requiredColumns(cfg) {
+		if _, ok := cols[field]; !ok {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("the header of '%s' has no %s column", s, strings.Join(missing, ", "))
+	}
+
+	if _, ok := cols["volume"]; !ok {
+		slog.Warn("No volume column in the header. Storing a volume of 0.", "file", s)
+	}
+
+	return cols, nil
+}
+
+// width returns the number of columns a row needs to hold every required field and the volume
+func (c columnIndex) width(cfg config) int {
+	fields := requiredColumns(cfg)
+	if _, ok := c["volume"]; ok {
+		fields = append(fields, "volume")
+	}
+
+	width := 0
+	for _, field := range fields {
+		if i := c[field]; i+1 > width {
+			width = i + 1
+		}
+	}
+
+	return width
+}
@@ -0,0 +1,57 @@
+package birdseed
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// writeDeadLetters stores the rows that failed to parse in the candles_errors table, so they
+// can be queried and triaged with SQL after the seed.
+func writeDeadLetters(db *sqlx.DB, rows []badRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	if err := ensureDeadLetterSchema(db); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(db.Rebind("INSERT INTO candles_errors (file, row, raw, error) VALUES (?,?,?,?)"))
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rows {
+		if _, err := stmt.Exec(r.file, r.row, rawRow(r.raw), r.err.Error()); err != nil {
+			return fmt.Errorf("could not store bad row %d of '%s'. %w", r.row, r.file, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	slog.Info("Stored rows that could not be parsed in candles_errors.", "rows", len(rows))
+
+	return nil
+}
+
+// rawRow encodes the fields of a row back into a csv line, quoting fields where needed
+func rawRow(fields []string) string {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(fields)
+	w.Flush()
+
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,52 @@
+package birdseed
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDeadLetterStoresMalformedRowsAndSeedsTheRest(t *testing.T) {
+	db := openTestDB(t)
+	dir := writeDataDir(t, map[string]string{
+		"COST.csv": "Date,Open,High,Low,Close,Volume\n" +
+			"2023-11-01,554.2,559.1,552.9,558.3,1900000\n" +
+			"2023-11-02,558.8,\"5,59.7\",556.1,n/a,2100000\n" +
+			"2023-11-03,563.4,566.9,561.9,566.1,1700000\n",
+		"WMT.csv": "Date,Open,High,Low,Close,Volume\n2023-11-01,163.7,164.3,162.9,163.9,5800000\n",
+	})
+	cfg := testConfig(t, "-data", dir, "-missing-table", "create", "-dead-letter")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, newReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := countCandles(t, db, "COST"); n != 2 {
+		t.Errorf("COST has %d candles, want the 2 good rows", n)
+	}
+	if n := countCandles(t, db, "WMT"); n != 1 {
+		t.Errorf("WMT has %d candles, want 1", n)
+	}
+
+	errs := []struct {
+		File  string `db:"file"`
+		Row   int    `db:"row"`
+		Raw   string `db:"raw"`
+		Error string `db:"error"`
+	}{}
+	if err := db.Select(&errs, "SELECT file, row, raw, error FROM candles_errors"); err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 {
+		t.Fatalf("stored %d dead letters, want 1", len(errs))
+	}
+	got := errs[0]
+	if got.File != "COST.csv" || got.Row != 3 || got.Raw != `2023-11-02,558.8,"5,59.7",556.1,n/a,2100000` {
+		t.Errorf("stored the dead letter %+v", got)
+	}
+	if !strings.Contains(got.Error, "row 3 of 'COST.csv'") {
+		t.Errorf("the stored error does not name the row: %s", got.Error)
+	}
+}
@@ -0,0 +1,182 @@
+package birdseed
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// sniffBytes is how much of the start of a file -autodetect looks at
+const sniffBytes = 4096
+
+// sniffLines is the number of lines -autodetect looks at
+const sniffLines = 5
+
+// delimiters are the delimiters -autodetect chooses between
+var delimiters = []rune{',', ';', '\t', '|'}
+
+// minColumns is the number of columns a row needs at least, one for each of the date, or ticker
+// of a universe dump, open, high, low and close. The volume is optional.
+const minColumns = 5
+
+// fileFormat describes how the rows of a csv file are laid out
+type fileFormat struct {
+	delimiter rune
+	// header is set when the first row holds column names rather than data
+	header bool
+	// dateLayout is the layout of the dates in the first column, tried before the others
+	dateLayout string
+	// decimalComma is set when numbers use a comma as the decimal mark, as in many European
+	// exports. It is never detected.
+	decimalComma bool
+}
+
+var defaultFormat = fileFormat{delimiter: ',', header: true, dateLayout: layoutISO}
+
+// detectFormat guesses the format of the named file from a sample of its first lines. Every
+// part of the format that cannot be told apart keeps its value from fallback, and what was
+// detected is logged per file.
+func detectFormat(s string, sample []byte, sampleFull bool, fallback fileFormat, cfg config) fileFormat {
+	lines := sampleRows(sample, sampleFull)
+	if len(lines) == 0 {
+		return fallback
+	}
+
+	format := fallback
+	notes := []string{}
+
+	if d, ok := detectDelimiter(lines, cfg); ok {
+		format.delimiter = d
+		notes = append(notes, fmt.Sprintf("delimiter %q", d))
+	} else {
+		notes = append(notes, fmt.Sprintf("delimiter %q (ambiguous)", format.delimiter))
+	}
+
+	first := splitRow(lines[0], format.delimiter)
+	format.header = len(first) < 2 || !isNumber(first[1], format.decimalComma)
+	if format.header {
+		notes = append(notes, "a header row")
+	} else {
+		notes = append(notes, "no header row")
+	}
+
+	// Universe dumps hold the ticker in the first column and take the date from the filename
+	if !cfg.universe {
+		data := lines
+		if format.header {
+			data = lines[1:]
+		}
+
+		if len(data) > 0 {
+			if layout, ok := detectDateLayout(splitRow(data[0], format.delimiter)[0], cfg); ok {
+				format.dateLayout = layout
+				notes = append(notes, "dates like "+layout)
+			} else {
+				notes = append(notes, "dates like "+format.dateLayout+" (ambiguous)")
+			}
+		}
+	}
+
+	slog.Info("Detected file format.", "file", s, "format", strings.Join(notes, ", "))
+
+	return format
+}
+
+// sampleRows returns the first non-empty lines of the sample, leaving out a last line that was
+// cut off by the end of a full sample
+func sampleRows(sample []byte, sampleFull bool) []string {
+	lines := strings.Split(strings.ReplaceAll(string(sample), "\r\n", "\n"), "\n")
+	if sampleFull && len(lines) > 1 {
+		lines = lines[:len(lines)-1]
+	}
+
+	rows := []string{}
+	for _, l := range lines {
+		if strings.TrimSpace(l) != "" {
+			rows = append(rows, l)
+		}
+		if len(rows) == sniffLines {
+			break
+		}
+	}
+
+	return rows
+}
+
+// detectDelimiter returns the delimiter that splits every line into the same number of enough
+// columns. When several do, the one whose last sampled line starts with a date, or a ticker and
+// a number for universe dumps, is chosen. Unlike the first line it is never a header row.
+func detectDelimiter(lines []string, cfg config) (rune, bool) {
+	candidates := []rune{}
+	for _, d := range delimiters {
+		n := strings.Count(lines[0], string(d))
+		if n+1 < minColumns {
+			continue
+		}
+
+		consistent := true
+		for _, l := range lines[1:] {
+			if strings.Count(l, string(d)) != n {
+				consistent = false
+				break
+			}
+		}
+		if consistent {
+			candidates = append(candidates, d)
+		}
+	}
+
+	if len(candidates) > 1 {
+		row := lines[len(lines)-1]
+		matching := []rune{}
+		for _, d := range candidates {
+			fields := splitRow(row, d)
+			if cfg.universe && isNumber(fields[1], cfg.format.decimalComma) {
+				matching = append(matching, d)
+			}
+			if _, ok := detectDateLayout(fields[0], cfg); !cfg.universe && ok {
+				matching = append(matching, d)
+			}
+		}
+		candidates = matching
+	}
+
+	if len(candidates) != 1 {
+		return 0, false
+	}
+
+	return candidates[0], true
+}
+
+// detectDateLayout returns the layout a date in the first column was written in
+func detectDateLayout(s string, cfg config) (string, bool) {
+	if _, err := time.Parse(layoutISO, s); err == nil {
+		return layoutISO, true
+	}
+
+	if _, err := time.Parse(layoutUS, s); err == nil {
+		return layoutUS, true
+	}
+
+	// ISO weeks and timestamps are recognized regardless of the layout
+	if _, _, err := parseDate(s, cfg); err == nil {
+		return layoutISO, true
+	}
+
+	return "", false
+}
+
+func splitRow(line string, delimiter rune) []string {
+	fields := strings.Split(line, string(delimiter))
+	for i, f := range fields {
+		fields[i] = strings.Trim(f, "\" ")
+	}
+
+	return fields
+}
+
+func isNumber(s string, decimalComma bool) bool {
+	_, err := parse(clean(s, decimalComma))
+	return err == nil
+}
@@ -0,0 +1,95 @@
+package birdseed
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDetectFormatAcceptsFilesWithoutVolume(t *testing.T) {
+	sample := []byte("Date\tOpen\tHigh\tLow\tClose\n05/01/2024\t1.5\t2\t1\t1.75\n05/02/2024\t1.75\t2.5\t1.5\t2\n")
+
+	format := detectFormat("NOVOL.tsv", sample, false, defaultFormat, testConfig(t))
+	if format.delimiter != '\t' {
+		t.Errorf("detected delimiter %q, want a tab", format.delimiter)
+	}
+	if !format.header {
+		t.Error("expected the header row to be detected")
+	}
+	if format.dateLayout != layoutUS {
+		t.Errorf("detected dates like %s, want %s", format.dateLayout, layoutUS)
+	}
+}
+
+func TestDetectDelimiterPicksTheOneSplittingDates(t *testing.T) {
+	// Both ; and , split every line into five columns, but only ; leaves a date in the first one
+	lines := []string{
+		"Date;Open,EUR;High,EUR;Low,EUR;Close,EUR",
+		"2024-01-02;1,5;2,5;1,5;2,5",
+	}
+
+	d, ok := detectDelimiter(lines, testConfig(t))
+	if !ok || d != ';' {
+		t.Errorf("detected %q (%v), want ';'", d, ok)
+	}
+}
+
+func TestAutodetectReadsAMixedDirectory(t *testing.T) {
+	db := openTestDB(t)
+	dir := writeDataDir(t, map[string]string{
+		"SAP.csv":  "Date,Open,High,Low,Close,Volume\n2024-06-03,176.2,178.9,175.8,178.4,1300000\n2024-06-04,178,179.1,176.5,177.2,1100000\n",
+		"ASML.csv": "Date;Open;High;Low;Close;Volume\n06/03/2024;905.1;918.4;901.2;915.7;820000\n06/04/2024;912.3;914;896.5;899.9;910000\n",
+	})
+	cfg := testConfig(t, "-data", dir, "-missing-table", "create", "-autodetect")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	logs := captureLogs(t)
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, newReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`file=ASML.csv format="delimiter ';', a header row, dates like 01/02/2006"`,
+		`file=SAP.csv format="delimiter ',', a header row, dates like 2006-01-02"`,
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("the log is missing %s, got\n%s", want, logs.String())
+		}
+	}
+
+	stored := []string{}
+	if err := db.Select(&stored, "SELECT ticker || ' ' || date || ' ' || close FROM candles ORDER BY ticker, date"); err != nil {
+		t.Fatal(err)
+	}
+	want := "ASML 2024-06-03 915.7,ASML 2024-06-04 899.9,SAP 2024-06-03 178.4,SAP 2024-06-04 177.2"
+	if got := strings.Join(stored, ","); got != want {
+		t.Errorf("stored %s, want %s", got, want)
+	}
+}
+
+func TestAutodetectReadsHeaderlessFilesOfFiveAndSixColumns(t *testing.T) {
+	dir := writeDataDir(t, map[string]string{
+		// An index without volume, and a pipe delimited export with it
+		"SPX.csv": "2024-07-01,5475.1,5490.8,5451.1,5475.1\n2024-07-02,5471.1,5509.7,5463.9,5509\n",
+		"DAX.csv": "07/01/2024|18317.4|18482.3|18286.8|18290.7|61200000\n07/02/2024|18282.1|18300.2|18113.6|18164.1|58400000\n",
+	})
+	cfg := testConfig(t, "-data", dir, "-autodetect")
+
+	spx, _, err := createCandles(dirSource{dir: dir}, "SPX.csv", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spx) != 2 || spx[1].storedDate() != "2024-07-02" || spx[1].Close != 5509 || spx[1].Volume != 0 {
+		t.Errorf("read the five column file as %+v", spx)
+	}
+
+	dax, _, err := createCandles(dirSource{dir: dir}, "DAX.csv", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dax) != 2 || dax[0].storedDate() != "2024-07-01" || dax[0].Close != 18290.7 || dax[0].Volume != 61200000 || dax[0].AdjClose != 18290.7 {
+		t.Errorf("read the six column file as %+v", dax)
+	}
+}
@@ -0,0 +1,205 @@
+package birdseed
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// diffDatabases compares the candles stored in the two databases given to diff-db and prints
+// every candle found in only one of them or with different values. Any difference fails the
+// command, so it can gate a migration in a script.
+func diffDatabases(w io.Writer, cfg config) error {
+	a, err := connectToURL(cfg.args[0], cfg)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	b, err := connectToURL(cfg.args[1], cfg)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	diffs, err := diffCandles(w, a, b, cfg.interval, cfg.tolerance)
+	if err != nil {
+		return err
+	}
+
+	if diffs > 0 {
+		return fmt.Errorf("the databases differ in %d candles", diffs)
+	}
+
+	fmt.Fprintln(w, "The databases hold the same candles.")
+	return nil
+}
+
+// diffCandles prints the differences between the candles of a and b per ticker, limited to an
+// interval if one is given, and returns how many there are
+func diffCandles(w io.Writer, a *sqlx.DB, b *sqlx.DB, interval string, tol float64) (int, error) {
+	tickersA, err := storedTickers(a)
+	if err != nil {
+		return 0, err
+	}
+
+	tickersB, err := storedTickers(b)
+	if err != nil {
+		return 0, err
+	}
+
+	tickers := map[string]bool{}
+	for _, t := range append(tickersA, tickersB...) {
+		tickers[t] = true
+	}
+
+	sorted := make([]string, 0, len(tickers))
+	for t := range tickers {
+		sorted = append(sorted, t)
+	}
+	sort.Strings(sorted)
+
+	diffs := 0
+	for _, ticker := range sorted {
+		candlesA, err := tickerCandles(a, ticker, interval)
+		if err != nil {
+			return 0, err
+		}
+
+		candlesB, err := tickerCandles(b, ticker, interval)
+		if err != nil {
+			return 0, err
+		}
+
+		diffs += diffTicker(w, candlesA, candlesB, tol)
+	}
+
+	return diffs, nil
+}
+
+// diffTicker compares the date ordered candles of a single ticker from both databases
+func diffTicker(w io.Writer, a []Candle, b []Candle, tol float64) int {
+	diffs := 0
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j == len(b) || (i < len(a) && a[i].storedDate() < b[j].storedDate()):
+			fmt.Fprintf(w, "only in first:  %s %s\n", a[i].Ticker, formatCandle(a[i]))
+			diffs++
+			i++
+		case i == len(a) || b[j].storedDate() < a[i].storedDate():
+			fmt.Fprintf(w, "only in second: %s %s\n", b[j].Ticker, formatCandle(b[j]))
+			diffs++
+			j++
+		default:
+			if !a[i].Equal(b[j], tol) {
+				fmt.Fprintf(w, "mismatch:       %s %s\n                %s %s\n", a[i].Ticker, formatCandle(a[i]), b[j].Ticker, formatCandle(b[j]))
+				diffs++
+			}
+			i++
+			j++
+		}
+	}
+
+	return diffs
+}
+
+// diffSamplesShown is the number of inserted and updated candles printed per ticker by -diff
+const diffSamplesShown = 3
+
+// diffSeed compares the candles a seed would write with the stored candles of each ticker and
+// prints how many would be inserted, updated under an upsert, or left unchanged, without
+// writing anything, not even a missing candles table or the index of -upsert.
+func diffSeed(w io.Writer, db *sqlx.DB, src source, cfg config) error {
+	exists, err := tableExists(db)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		if err := checkSchema(db, cfg); err != nil {
+			return err
+		}
+	} else {
+		slog.Info("The candles table does not exist, so every candle would be inserted.")
+		db = nil
+	}
+
+	// Every file is read, including tickers a seed would skip because they already have data
+	candles, err := aggregateCandlesFromFiles(context.Background(), nil, src, cfg, newReport())
+	if err != nil {
+		return fmt.Errorf("could not load data from csv files. %w", err)
+	}
+	candles = normalizeCandles(candles)
+
+	inserts, updates, unchanged := 0, 0, 0
+	for start := 0; start < len(candles); {
+		end := start + 1
+		for end < len(candles) && candles[end].Ticker == candles[start].Ticker {
+			end++
+		}
+
+		i, u, n, err := diffTickerSeed(w, db, candles[start:end], cfg.interval, cfg.tolerance)
+		if err != nil {
+			return err
+		}
+		inserts, updates, unchanged = inserts+i, updates+u, unchanged+n
+
+		start = end
+	}
+
+	fmt.Fprintf(w, "Total: %d to insert, %d to update, %d unchanged\n", inserts, updates, unchanged)
+	return nil
+}
+
+// diffTickerSeed classifies the candles of a single ticker against its stored candles of the
+// same interval
+func diffTickerSeed(w io.Writer, db *sqlx.DB, candles []Candle, interval string, tol float64) (int, int, int, error) {
+	ticker := candles[0].Ticker
+	existing := []Candle{}
+	if db != nil {
+		var err error
+		if existing, err = tickerCandles(db, ticker, interval); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+
+	stored := make(map[string]Candle, len(existing))
+	for _, c := range existing {
+		stored[c.storedDate()] = c
+	}
+
+	inserts, updates := []Candle{}, [][2]Candle{}
+	unchanged := 0
+	for _, c := range candles {
+		old, ok := stored[c.storedDate()]
+		switch {
+		case !ok:
+			inserts = append(inserts, c)
+		case !old.Equal(c, tol):
+			updates = append(updates, [2]Candle{old, c})
+		default:
+			unchanged++
+		}
+	}
+
+	fmt.Fprintf(w, "%s: %d to insert, %d to update, %d unchanged\n", ticker, len(inserts), len(updates), unchanged)
+	for i, c := range inserts {
+		if i == diffSamplesShown {
+			break
+		}
+		fmt.Fprintf(w, "  insert: %s\n", formatCandle(c))
+	}
+	for i, u := range updates {
+		if i == diffSamplesShown {
+			break
+		}
+		fmt.Fprintf(w, "  update: %s\n       -> %s\n", formatCandle(u[0]), formatCandle(u[1]))
+	}
+
+	return len(inserts), len(updates), unchanged, nil
+}
@@ -0,0 +1,174 @@
+package birdseed
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestDiffDatabasesComparesOnlyTheGivenInterval(t *testing.T) {
+	a, b := openTestDB(t), openTestDB(t)
+	daily := testConfig(t, "-missing-table", "create", "-interval", "daily")
+	weekly := testConfig(t, "-interval", "weekly")
+	for _, db := range []*sqlx.DB{a, b} {
+		if err := prepareSchema(db, daily); err != nil {
+			t.Fatal(err)
+		}
+		if err := bulkInsert(context.Background(), db, []Candle{
+			{Ticker: "AAA", Date: day("2024-01-08"), Open: 1, High: 2, Low: 1, Close: 2, Interval: "daily"},
+		}, daily); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Only the first database has the weekly candle of the same monday
+	if err := bulkInsert(context.Background(), a, []Candle{
+		{Ticker: "AAA", Date: day("2024-01-08"), Open: 1, High: 3, Low: 1, Close: 3, Interval: "weekly"},
+	}, weekly); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	diffs, err := diffCandles(&out, a, b, "daily", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diffs != 0 {
+		t.Errorf("the daily candles are equal, but %d differences were found:\n%s", diffs, out.String())
+	}
+
+	out.Reset()
+	if diffs, err = diffCandles(&out, a, b, "weekly", 0); err != nil {
+		t.Fatal(err)
+	}
+	if diffs != 1 || !strings.Contains(out.String(), "only in first:  AAA 2024-01-08") {
+		t.Errorf("expected the weekly candle only in the first database, got %d differences:\n%s", diffs, out.String())
+	}
+}
+
+func TestDiffDBReportsAMissingRowAndAMismatch(t *testing.T) {
+	paths := []string{filepath.Join(t.TempDir(), "old.db"), filepath.Join(t.TempDir(), "new.db")}
+	candles := []Candle{
+		{Ticker: "UNH", Date: day("2021-03-01"), Open: 335, High: 339.9, Low: 333.3, Close: 339.6, Volume: 3100000},
+		{Ticker: "UNH", Date: day("2021-03-02"), Open: 339, High: 342.1, Low: 336, Close: 337.4, Volume: 2900000},
+		{Ticker: "UNH", Date: day("2021-03-03"), Open: 337, High: 338.5, Low: 332.1, Close: 333.9, Volume: 3300000},
+	}
+	for i, path := range paths {
+		db, err := openDatabase("libsql", "file:"+path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		if err := prepareSchema(db, testConfig(t, "-missing-table", "create")); err != nil {
+			t.Fatal(err)
+		}
+
+		migrated := append([]Candle(nil), candles...)
+		if i == 1 {
+			// The migration lost a day, changed a close and added float noise to another
+			migrated = []Candle{candles[0], candles[2]}
+			migrated[0].Open += 1e-12
+			migrated[1].Close = 334.1
+		}
+		if err := bulkInsert(context.Background(), db, migrated, testConfig(t)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	err := diffDatabases(&out, testConfig(t, "diff-db", "-tolerance", "1e-9", "file:"+paths[0], "file:"+paths[1]))
+	if err == nil || err.Error() != "the databases differ in 2 candles" {
+		t.Errorf("expected 2 differences, got %v", err)
+	}
+	want := "only in first:  UNH 2021-03-02 O=339 H=342.1 L=336 C=337.4 V=2900000\n" +
+		"mismatch:       UNH 2021-03-03 O=337 H=338.5 L=332.1 C=333.9 V=3300000\n" +
+		"                UNH 2021-03-03 O=337 H=338.5 L=332.1 C=334.1 V=3300000\n"
+	if out.String() != want {
+		t.Errorf("diff-db printed\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestDiffClassifiesInsertsUpdatesAndUnchangedCandles(t *testing.T) {
+	db := openTestDB(t)
+	header := "Date,Open,High,Low,Close,Volume\n"
+	seeded := writeDataDir(t, map[string]string{
+		"COST.csv": header + "2023-05-01,505,507.2,502.1,506.4,1700000\n2023-05-02,506,508,503.3,504.9,1500000\n",
+	})
+	cfg := testConfig(t, "-data", seeded, "-missing-table", "create")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := seedDatabase(context.Background(), db, dirSource{dir: seeded}, cfg, newReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The vendor restated the close of 2023-05-02, added a day and a new ticker
+	dir := writeDataDir(t, map[string]string{
+		"COST.csv": header + "2023-05-01,505,507.2,502.1,506.4,1700000\n2023-05-02,506,508,503.3,505.2,1500000\n2023-05-03,505,509.9,504.6,509.1,1900000\n",
+		"WMT.csv":  header + "2023-05-01,151.4,152.6,150.9,152.3,5200000\n",
+	})
+	var out bytes.Buffer
+	if err := diffSeed(&out, db, dirSource{dir: dir}, testConfig(t, "-data", dir, "-diff")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "COST: 1 to insert, 1 to update, 1 unchanged\n" +
+		"  insert: 2023-05-03 O=505 H=509.9 L=504.6 C=509.1 V=1900000\n" +
+		"  update: 2023-05-02 O=506 H=508 L=503.3 C=504.9 V=1500000\n" +
+		"       -> 2023-05-02 O=506 H=508 L=503.3 C=505.2 V=1500000\n" +
+		"WMT: 1 to insert, 0 to update, 0 unchanged\n" +
+		"  insert: 2023-05-01 O=151.4 H=152.6 L=150.9 C=152.3 V=5200000\n" +
+		"Total: 2 to insert, 1 to update, 1 unchanged\n"
+	if out.String() != want {
+		t.Errorf("-diff printed\n%s\nwant\n%s", out.String(), want)
+	}
+	if n := countCandles(t, db, "COST") + countCandles(t, db, "WMT"); n != 2 {
+		t.Errorf("-diff wrote to the database, it holds %d candles", n)
+	}
+}
+
+func TestDiffWritesNothingToTheDatabase(t *testing.T) {
+	defaultLogger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	path := filepath.Join(t.TempDir(), "candles.db")
+	env := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(env, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DSN", "file:"+path)
+	dir := writeDataDir(t, map[string]string{
+		"HD.csv": "Date,Open,High,Low,Close,Volume\n2023-04-03,294.2,296.8,292.5,296.1,3400000\n",
+	})
+	db, err := openDatabase("libsql", "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Neither the missing table of the default -missing-table create is created...
+	if err := Run([]string{"-env", env, "-data", dir, "-diff"}); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := tableExists(db); err != nil || exists {
+		t.Fatalf("-diff created the candles table (%v)", err)
+	}
+
+	// ...nor the index of -upsert on an existing table
+	db.MustExec("CREATE TABLE candles (id INTEGER PRIMARY KEY AUTOINCREMENT, ticker TEXT NOT NULL, date TEXT NOT NULL, open REAL, high REAL, low REAL, close REAL, volume INTEGER)")
+	if err := Run([]string{"-env", env, "-data", dir, "-diff", "-upsert"}); err != nil {
+		t.Fatal(err)
+	}
+	var indexes int
+	if err := db.Get(&indexes, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND tbl_name = 'candles'"); err != nil {
+		t.Fatal(err)
+	}
+	if indexes != 0 {
+		t.Error("-diff -upsert created the unique index")
+	}
+}
@@ -0,0 +1,67 @@
+package birdseed
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// dryRun runs everything a seed does up to inserting, including the read-only checks for data
+// that is already stored, and prints how many candles per ticker would be inserted instead.
+// Nothing is written, not even a missing candles table.
+func dryRun(w io.Writer, db *sqlx.DB, src source, cfg config) error {
+	exists, err := tableExists(db)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		if err := checkSchema(db, cfg); err != nil {
+			return err
+		}
+	} else {
+		slog.Info("The candles table does not exist, so every candle would be inserted.")
+		db = nil
+	}
+
+	// Candles must not reach the database early
+	cfg.insertWorkers = 0
+
+	rep := newReport()
+	if _, err := aggregateCandlesFromFiles(context.Background(), db, src, cfg, rep); err != nil {
+		return fmt.Errorf("could not load data from csv files. %w", err)
+	}
+
+	tickers := make([]string, 0, len(rep.counts))
+	for ticker := range rep.counts {
+		tickers = append(tickers, ticker)
+	}
+	sort.Strings(tickers)
+
+	fmt.Fprintln(w, "Candles that would be inserted:")
+	for _, ticker := range tickers {
+		fmt.Fprintf(w, "  %s: %d\n", ticker, rep.counts[ticker])
+	}
+
+	summary := rep.summary(nil)
+	if len(summary.Skipped) > 0 {
+		fmt.Fprintf(w, "Tickers that would be skipped because their data exists: %d\n", len(summary.Skipped))
+		for _, ticker := range summary.Skipped {
+			fmt.Fprintf(w, "  %s\n", ticker)
+		}
+	}
+
+	if len(rep.badRows) > 0 {
+		fmt.Fprintf(w, "Rows that would be skipped: %d\n", len(rep.badRows))
+		for _, b := range rep.badRows {
+			fmt.Fprintf(w, "  %s\n", b.err)
+		}
+	}
+
+	fmt.Fprintf(w, "Total: %d candles would be inserted.\n", rep.total())
+	return nil
+}
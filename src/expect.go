@@ -0,0 +1,72 @@
+package birdseed
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// loadExpectedCounts reads a csv file of ticker,count lines, with an optional header row,
+// mapping each ticker to the number of candles it is expected to have.
+func loadExpectedCounts(path string) (map[string]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open -expect-counts file. %w", err)
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("could not read -expect-counts file. %w", err)
+	}
+
+	expected := map[string]int{}
+	for i, r := range records {
+		if len(r) != 2 {
+			return nil, fmt.Errorf("line %d of -expect-counts file has %d fields, expected ticker,count", i+1, len(r))
+		}
+
+		if i == 0 && strings.EqualFold(strings.TrimSpace(r[0]), "ticker") {
+			continue
+		}
+
+		count, err := strconv.Atoi(strings.TrimSpace(r[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d of -expect-counts file has an invalid count '%s'", i+1, r[1])
+		}
+		expected[strings.TrimSpace(r[0])] = count
+	}
+
+	return expected, nil
+}
+
+// checkExpectedCounts compares the number of aggregated candles per ticker with the expected
+// counts. Tickers that were skipped because their data already exists are not checked.
+func checkExpectedCounts(expected map[string]int, rep *report) error {
+	counts := rep.counts
+
+	tickers := make([]string, 0, len(expected))
+	for ticker := range expected {
+		tickers = append(tickers, ticker)
+	}
+	sort.Strings(tickers)
+
+	mismatches := []string{}
+	for _, ticker := range tickers {
+		if rep.skipped[ticker] {
+			continue
+		}
+		if counts[ticker] != expected[ticker] {
+			mismatches = append(mismatches, fmt.Sprintf("%s: expected %d, got %d", ticker, expected[ticker], counts[ticker]))
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return fmt.Errorf("candle counts do not match -expect-counts. %s", strings.Join(mismatches, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package birdseed
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpectedCountsFailOnTheTickerThatIsOff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counts.csv")
+	if err := os.WriteFile(path, []byte("ticker,count\nAAPL,252\nMSFT, 252\nBRK.B,251\nNEWCO,20\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := loadExpectedCounts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expected) != 4 || expected["MSFT"] != 252 {
+		t.Fatalf("loaded %v", expected)
+	}
+
+	// NEWCO already has data, so its file was skipped and is not counted
+	rep := newReport()
+	rep.counts = map[string]int{"AAPL": 252, "MSFT": 252, "BRK.B": 250}
+	rep.skipped["NEWCO"] = true
+
+	err = checkExpectedCounts(expected, rep)
+	if err == nil {
+		t.Fatal("expected BRK.B being one candle short to fail")
+	}
+	if !strings.HasSuffix(err.Error(), "BRK.B: expected 251, got 250") {
+		t.Errorf("the error should only name BRK.B, got %v", err)
+	}
+
+	rep.counts["BRK.B"] = 251
+	if err := checkExpectedCounts(expected, rep); err != nil {
+		t.Errorf("matching counts failed: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package birdseed
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// exportCandles writes the stored candles of the -export ticker, optionally limited to the days
+// from -from up to and including -to and to an -interval, to -out as a csv file in the import format
+func exportCandles(db *sqlx.DB, cfg config) error {
+	candles, err := storedRange(db, cfg.export, cfg.interval, cfg.from, cfg.to)
+	if err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if cfg.out != "-" {
+		f, err := os.Create(cfg.out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := writeCSV(w, candles); err != nil {
+		return fmt.Errorf("could not export ticker '%s'. %w", cfg.export, err)
+	}
+	slog.Info("Successfully exported candles.", "ticker", cfg.export, "candles", len(candles), "file", cfg.out)
+
+	return nil
+}
+
+// storedRange returns the stored candles of a ticker ordered by date, from the day of from up to
+// and including the day of to, within the given interval if any. A zero from or to leaves that
+// end of the range open.
+func storedRange(db *sqlx.DB, ticker string, interval string, from time.Time, to time.Time) ([]Candle, error) {
+	query, err := selectCandles(db)
+	if err != nil {
+		return nil, err
+	}
+
+	scope, args := intervalClause(interval)
+	query += " WHERE ticker = ?" + scope
+	args = append([]any{ticker}, args...)
+	if !from.IsZero() {
+		query += " AND date >= ?"
+		args = append(args, from.Format(layoutISO))
+	}
+	if !to.IsZero() {
+		query += " AND date < ?"
+		args = append(args, to.AddDate(0, 0, 1).Format(layoutISO))
+	}
+
+	rows := []candleRow{}
+	if err := db.Select(&rows, db.Rebind(query+" ORDER BY date"), args...); err != nil {
+		return nil, fmt.Errorf("could not fetch candles for ticker '%s'. %w", ticker, err)
+	}
+
+	return toCandles(rows)
+}
@@ -0,0 +1,70 @@
+package birdseed
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportRoundTripsTheAdjustedClose(t *testing.T) {
+	db := openTestDB(t)
+	dir := writeDataDir(t, map[string]string{
+		"KO.csv": "Date,Open,High,Low,Close,Adj Close,Volume\n" +
+			"2024-01-02,10,12,9,11,10.5,100\n" +
+			"2024-01-03,11,13,10,12,11.25,200\n",
+	})
+	cfg := testConfig(t, "-data", dir, "-missing-table", "create", "-with-adj-close")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, newReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "KO.csv")
+	if err := exportCandles(db, testConfig(t, "-export", "KO", "-out", out)); err != nil {
+		t.Fatal(err)
+	}
+
+	exported, _, err := createCandles(dirSource{dir: filepath.Dir(out)}, "KO.csv", testConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{10.5, 11.25}
+	if len(exported) != len(want) {
+		t.Fatalf("exported %d candles, want %d", len(exported), len(want))
+	}
+	for i, c := range exported {
+		if c.AdjClose != want[i] {
+			t.Errorf("candle %d has adj close %g, want %g", i, c.AdjClose, want[i])
+		}
+	}
+}
+
+func TestExportFallsBackToTheCloseWithoutAnAdjCloseColumn(t *testing.T) {
+	db := openTestDB(t)
+	dir := writeDataDir(t, map[string]string{
+		"KO.csv": "Date,Open,High,Low,Close,Adj Close,Volume\n2024-01-02,10,12,9,11,10.5,100\n",
+	})
+	cfg := testConfig(t, "-data", dir, "-missing-table", "create")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, newReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	candles, err := storedRange(db, "KO", "", cfg.from, cfg.to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeCSV(&buf, candles); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "2024-01-02,10,12,9,11,11,100,KO") {
+		t.Errorf("export without an adj_close column should repeat the close, got\n%s", buf.String())
+	}
+}
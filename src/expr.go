@@ -0,0 +1,290 @@
+package birdseed
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// filterExpr is a parsed -filter-expr expression such as 'volume > 0 && close >= 10'.
+//
+// The grammar is kept minimal:
+//
+//	expr       = and { "||" and }
+//	and        = unary { "&&" unary }
+//	unary      = "!" unary | "(" expr ")" | comparison
+//	comparison = operand ( "==" | "!=" | "<" | "<=" | ">" | ">=" ) operand
+//	operand    = field | number | 'string'
+//
+// The numeric fields are open, high, low, close and volume, the string fields are ticker and
+// date, where date is compared in its stored form, e.g. date >= '2024-01-01'.
+type filterExpr interface {
+	eval(c Candle) bool
+}
+
+type orExpr struct{ left, right filterExpr }
+type andExpr struct{ left, right filterExpr }
+type notExpr struct{ expr filterExpr }
+
+type compareExpr struct {
+	op          string
+	left, right operand
+}
+
+func (e orExpr) eval(c Candle) bool  { return e.left.eval(c) || e.right.eval(c) }
+func (e andExpr) eval(c Candle) bool { return e.left.eval(c) && e.right.eval(c) }
+func (e notExpr) eval(c Candle) bool { return !e.expr.eval(c) }
+
+func (e compareExpr) eval(c Candle) bool {
+	if e.left.numeric {
+		return compare(e.op, e.left.number(c), e.right.number(c))
+	}
+
+	return compare(e.op, e.left.text(c), e.right.text(c))
+}
+
+func compare[T float64 | string](op string, a, b T) bool {
+	switch op {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	default:
+		return a >= b
+	}
+}
+
+// operand is either a candle field or a literal value
+type operand struct {
+	field   string
+	numeric bool
+	num     float64
+	str     string
+}
+
+func (o operand) number(c Candle) float64 {
+	switch o.field {
+	case "open":
+		return c.Open
+	case "high":
+		return c.High
+	case "low":
+		return c.Low
+	case "close":
+		return c.Close
+	case "volume":
+		return float64(c.Volume)
+	}
+
+	return o.num
+}
+
+func (o operand) text(c Candle) string {
+	switch o.field {
+	case "ticker":
+		return c.Ticker
+	case "date":
+		return c.storedDate()
+	}
+
+	return o.str
+}
+
+var numericFields = map[string]bool{"open": true, "high": true, "low": true, "close": true, "volume": true}
+var stringFields = map[string]bool{"ticker": true, "date": true}
+var operators = map[string]bool{"==": true, "!=": true, "<=": true, ">=": true, "&&": true, "||": true}
+
+// parseFilterExpr parses an expression for -filter-expr
+func parseFilterExpr(s string) (filterExpr, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s' in filter expression", p.tokens[p.pos])
+	}
+
+	return expr, nil
+}
+
+type exprParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+
+	return ""
+}
+
+func (p *exprParser) next() string {
+	t := p.peek()
+	p.pos++
+
+	return t
+}
+
+func (p *exprParser) parseOr() (filterExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (filterExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "&&" {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (filterExpr, error) {
+	switch p.peek() {
+	case "!":
+		p.next()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{expr}, nil
+	case "(":
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing ')' in filter expression")
+		}
+		return expr, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (filterExpr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.next()
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return nil, fmt.Errorf("expected a comparison operator in filter expression, got '%s'", op)
+	}
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	if left.numeric != right.numeric {
+		return nil, fmt.Errorf("cannot compare a number with a string in filter expression")
+	}
+
+	return compareExpr{op: op, left: left, right: right}, nil
+}
+
+func (p *exprParser) parseOperand() (operand, error) {
+	t := p.next()
+	switch {
+	case t == "":
+		return operand{}, fmt.Errorf("unexpected end of filter expression")
+	case strings.HasPrefix(t, "'"):
+		return operand{str: strings.Trim(t, "'")}, nil
+	case numericFields[t]:
+		return operand{field: t, numeric: true}, nil
+	case stringFields[t]:
+		return operand{field: t}, nil
+	}
+
+	n, err := strconv.ParseFloat(t, 64)
+	if err != nil {
+		return operand{}, fmt.Errorf("unknown field '%s' in filter expression", t)
+	}
+
+	return operand{numeric: true, num: n}, nil
+}
+
+func tokenize(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		r := rune(s[i])
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("()", r):
+			tokens = append(tokens, string(r))
+			i++
+		case r == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string in filter expression")
+			}
+			tokens = append(tokens, s[i:i+end+2])
+			i += end + 2
+		case strings.ContainsRune("=!<>&|", r):
+			if i+1 < len(s) && operators[s[i:i+2]] {
+				tokens = append(tokens, s[i:i+2])
+				i += 2
+			} else if strings.ContainsRune("!<>", r) {
+				tokens = append(tokens, string(r))
+				i++
+			} else {
+				return nil, fmt.Errorf("unexpected '%c' in filter expression", r)
+			}
+		default:
+			start := i
+			for i < len(s) && (unicode.IsLetter(rune(s[i])) || unicode.IsDigit(rune(s[i])) || strings.ContainsRune(".-_", rune(s[i]))) {
+				i++
+			}
+			if start == i {
+				return nil, fmt.Errorf("unexpected '%c' in filter expression", r)
+			}
+			tokens = append(tokens, strings.ToLower(s[start:i]))
+		}
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,37 @@
+package birdseed
+
+import "testing"
+
+func TestFilterExprEvaluatesCandles(t *testing.T) {
+	penny := Candle{Ticker: "SNDL", Date: day("2021-02-10"), Open: 3.2, High: 3.96, Low: 2.1, Close: 2.54, Volume: 1500000}
+	halted := Candle{Ticker: "GME", Date: day("2021-01-28"), Open: 265, High: 483, Low: 112.25, Close: 193.6, Volume: 0}
+	stock := Candle{Ticker: "GME", Date: day("2021-02-10"), Open: 50.8, High: 60, Low: 50, Close: 51.1, Volume: 37000000}
+
+	for _, tc := range []struct {
+		expr string
+		want []bool
+	}{
+		{"volume > 0 && close >= 10", []bool{false, false, true}},
+		{"ticker == 'GME' || close < 3", []bool{true, true, true}},
+		{"!(volume == 0) && date >= '2021-02-01'", []bool{true, false, true}},
+		{"high - low", nil},
+	} {
+		expr, err := parseFilterExpr(tc.expr)
+		if tc.want == nil {
+			if err == nil {
+				t.Errorf("%q should not parse", tc.expr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q failed to parse: %v", tc.expr, err)
+			continue
+		}
+
+		for i, c := range []Candle{penny, halted, stock} {
+			if got := expr.eval(c); got != tc.want[i] {
+				t.Errorf("%q on %s %s = %v, want %v", tc.expr, c.Ticker, c.storedDate(), got, tc.want[i])
+			}
+		}
+	}
+}
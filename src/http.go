@@ -0,0 +1,66 @@
+package birdseed
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// httpSource reads a single csv file from an http:// or https:// URL, streaming the response
+// body into the csv reader rather than staging it on disk
+type httpSource struct {
+	client *http.Client
+	url    string
+	// name is the file name the ticker is derived from
+	name string
+}
+
+// isURL reports whether the -data argument is an http:// or https:// URL rather than a directory
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// newHTTPSource creates a source for the URL. The ticker is the given one, or else derived from
+// the last path segment of the URL as for a ticker.csv file.
+func newHTTPSource(location string, ticker string, timeout time.Duration) (httpSource, error) {
+	u, err := url.Parse(location)
+	if err != nil || u.Host == "" {
+		return httpSource{}, fmt.Errorf("invalid -data URL '%s'", location)
+	}
+
+	name := path.Base(u.Path)
+	if ticker != "" {
+		// Keep a .gz suffix so a compressed response is still decompressed
+		name = ticker + ".csv"
+		if strings.HasSuffix(u.Path, ".gz") {
+			name += ".gz"
+		}
+	}
+	if _, err := tickerFromFilename(name); err != nil {
+		return httpSource{}, fmt.Errorf("could not derive a ticker from the URL '%s', set it with -url-ticker", location)
+	}
+
+	return httpSource{client: &http.Client{Timeout: timeout}, url: location, name: name}, nil
+}
+
+func (s httpSource) files() ([]string, error) {
+	return []string{s.name}, nil
+}
+
+func (s httpSource) open(name string) (io.ReadCloser, error) {
+	resp, err := s.client.Get(s.url)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch '%s'. %w", s.url, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("could not fetch '%s', got status '%s'", s.url, resp.Status)
+	}
+
+	return resp.Body, nil
+}
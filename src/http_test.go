@@ -0,0 +1,95 @@
+package birdseed
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPSourceSeedsTheTickerOfTheURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/eod/NVDA.csv", "/download":
+			io.WriteString(w, "Date,Open,High,Low,Close,Volume\n2024-09-03,116,116.2,107.3,108,477000000\n2024-09-04,105.4,113.3,104.1,106.2,372000000\n")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	db := openTestDB(t)
+	if err := prepareSchema(db, testConfig(t, "-missing-table", "create")); err != nil {
+		t.Fatal(err)
+	}
+	for _, run := range []struct {
+		args   []string
+		ticker string
+	}{
+		{[]string{"-data", srv.URL + "/eod/NVDA.csv"}, "NVDA"},
+		// The last segment of the URL is no ticker file, so the ticker is given
+		{[]string{"-data", srv.URL + "/download?symbol=nvda", "-url-ticker", "nvda.o"}, "NVDA.O"},
+	} {
+		cfg := testConfig(t, run.args...)
+		src, err := newSource(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := seedDatabase(context.Background(), db, src, cfg, newReport()); err != nil {
+			t.Fatal(err)
+		}
+		if n := countCandles(t, db, run.ticker); n != 2 {
+			t.Errorf("%s has %d candles, want 2", run.ticker, n)
+		}
+	}
+
+	if _, err := newSource(testConfig(t, "-data", srv.URL+"/?symbol=nvda")); err == nil || !strings.Contains(err.Error(), "set it with -url-ticker") {
+		t.Errorf("expected a URL without a ticker to ask for -url-ticker, got %v", err)
+	}
+}
+
+func TestHTTPSourceStopsTheSeedOnAFailedRequest(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow/AMD.csv" {
+			<-release
+			return
+		}
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	db := openTestDB(t)
+	cfg := testConfig(t, "-data", srv.URL+"/AMD.csv", "-missing-table", "create")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	src, err := newSource(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = seedDatabase(context.Background(), db, src, cfg, newReport())
+	if err == nil || !strings.Contains(err.Error(), "got status '429 Too Many Requests'") {
+		t.Errorf("expected the 429 response to stop the seed, got %v", err)
+	}
+	if n := countCandles(t, db, "AMD"); n != 0 {
+		t.Errorf("the failed request seeded %d candles", n)
+	}
+
+	cfg = testConfig(t, "-data", srv.URL+"/slow/AMD.csv", "-http-timeout", "50ms")
+	if src, err = newSource(cfg); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	err = seedDatabase(context.Background(), db, src, cfg, newReport())
+	if err == nil || !strings.Contains(err.Error(), "Timeout") {
+		t.Errorf("expected the request to time out, got %v", err)
+	}
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("-http-timeout was not honored, the request took %s", took)
+	}
+}
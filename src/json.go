@@ -0,0 +1,148 @@
+package birdseed
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"strings"
+)
+
+// jsonColumns is the layout of the rows that the fields of a JSON candle object are put into, so
+// they are parsed and validated like the columns of a csv row
+var jsonColumns = columnIndex{"date": 0, "open": 1, "high": 2, "low": 3, "close": 4, "adj_close": 5, "volume": 6, "ticker": 7}
+
+// isJSONFile reports whether the named file, possibly compressed, holds JSON rather than csv
+func isJSONFile(s string) bool {
+	return strings.EqualFold(path.Ext(strings.TrimSuffix(s, ".gz")), ".json")
+}
+
+// readJSONCandles parses the JSON data of the named file into candles. The file holds either an
+// array of candle objects or an object of candle objects keyed by their date. The fields of an
+// object are named like the columns of a csv header, so 'date', 'open', 'high', 'low', 'close',
+// 'adj close' and 'volume' in any case, with numbers given as JSON numbers or strings.
+func readJSONCandles(r io.Reader, s string, cfg config) ([]Candle, []badRow, error) {
+	ticker, date, err := fileTickerAndDate(s, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// JSON numbers always have a decimal point, whatever -decimal-comma says about csv files
+	cfg.format.decimalComma = false
+
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	shape, err := dec.Token()
+	// An empty file is treated as an empty csv file
+	if err == io.EOF {
+		if !cfg.skipBadRows {
+			return nil, nil, fmt.Errorf("'%s' is empty", s)
+		}
+		slog.Warn("Skipping empty file.", "file", s)
+		return []Candle{}, []badRow{}, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read '%s'. %w", s, err)
+	}
+	keyed := shape == json.Delim('{')
+	if !keyed && shape != json.Delim('[') {
+		return nil, nil, fmt.Errorf("'%s' must hold a JSON array of candle objects or an object of candle objects keyed by date", s)
+	}
+
+	candles := []Candle{}
+	bad := []badRow{}
+	// entry is the 1-based position of the candle object in the file
+	for entry := 1; dec.More(); entry++ {
+		key := ""
+		if keyed {
+			t, err := dec.Token()
+			if err != nil {
+				return nil, nil, fmt.Errorf("could not read entry %d of '%s'. %w", entry, s, err)
+			}
+			key = t.(string)
+		}
+
+		var fields map[string]any
+		if err := dec.Decode(&fields); err != nil {
+			return nil, nil, fmt.Errorf("entry %d of '%s' is not a candle object. %w", entry, s, err)
+		}
+
+		d, cols, err := jsonRow(fields, key, cfg)
+		if err == nil {
+			// Detect the date layout from the first entry, as for the first row of a csv file
+			if entry == 1 && !cfg.universe {
+				if layout, ok := detectDateLayout(d[cols["date"]], cfg); ok {
+					cfg.format.dateLayout = layout
+				}
+			}
+
+			var candle Candle
+			if candle, err = parseRow(ticker, date, cols, d, cfg); err == nil {
+				candle.Source = s
+				candle.Row = entry
+				candle.Interval = cfg.interval
+				candles = append(candles, candle)
+				continue
+			}
+		}
+
+		b, err := rejectRow(s, entry, d, fmt.Errorf("entry %d of '%s'. %w", entry, s, err), cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		bad = append(bad, b)
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, fmt.Errorf("could not read '%s'. %w", s, err)
+	}
+	if len(candles) == 0 && len(bad) == 0 {
+		slog.Warn("No data rows for ticker.", "ticker", ticker, "file", s)
+	}
+
+	return finishCandles(s, candles, bad, cfg)
+}
+
+// jsonRow puts the fields of a candle object into a row in the jsonColumns layout, with key as
+// its date if it has no date field. Missing optional fields, such as the volume, are left out
+// of the columns.
+func jsonRow(fields map[string]any, key string, cfg config) ([]string, columnIndex, error) {
+	d := make([]string, len(jsonColumns))
+	cols := columnIndex{}
+	if key != "" {
+		d[jsonColumns["date"]] = key
+		cols["date"] = jsonColumns["date"]
+	}
+
+	for name, v := range fields {
+		field, ok := headerNames[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			continue
+		}
+
+		switch v := v.(type) {
+		case json.Number:
+			d[jsonColumns[field]] = v.String()
+		case string:
+			d[jsonColumns[field]] = v
+		case nil:
+			continue
+		default:
+			return d, nil, fmt.Errorf("the %s field must be a number or a string, got %v", name, v)
+		}
+		cols[field] = jsonColumns[field]
+	}
+
+	missing := []string{}
+	for _, field := range requiredColumns(cfg) {
+		if _, ok := cols[field]; !ok {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return d, nil, fmt.Errorf("the candle object has no %s field", strings.Join(missing, ", "))
+	}
+
+	return d, cols, nil
+}
@@ -0,0 +1,61 @@
+// Package birdseed reads candles from csv stock data and seeds them into a database. The
+// command line in cmd/birdseed is a wrapper over Run, and Seed, LoadCandles and FetchCandles
+// expose the same logic to other programs with the default options.
+package birdseed
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Seed inserts the candles into the candles table, creating it and its unique index on
+// (ticker, date) if it does not exist
+func Seed(db *sqlx.DB, candles []Candle) error {
+	cfg, err := parseFlags(nil)
+	if err != nil {
+		return err
+	}
+
+	if err := prepareSchema(db, cfg); err != nil {
+		return err
+	}
+
+	if err := bulkInsert(context.Background(), db, candles, cfg); err != nil {
+		return fmt.Errorf("could not seed data. %w", err)
+	}
+
+	return nil
+}
+
+// LoadCandles parses the candles of a csv file, or of every csv file in a directory, with the
+// ticker taken from each file name as for the command line
+func LoadCandles(path string) ([]Candle, error) {
+	cfg, err := parseFlags(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		cfg.dataDir = path
+		return aggregateCandlesFromFiles(context.Background(), nil, dirSource{dir: path}, cfg, newReport())
+	}
+
+	candles, _, err := createCandles(dirSource{dir: filepath.Dir(path)}, filepath.Base(path), cfg)
+	return candles, err
+}
+
+// FetchCandles returns the stored candles of a ticker dated from the day of from up to and
+// including the day of to, ordered by date
+func FetchCandles(db *sqlx.DB, ticker string, from time.Time, to time.Time) ([]Candle, error) {
+	return fetchCandles(db, ticker, from, to)
+}
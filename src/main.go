@@ -1,17 +1,33 @@
-package main
+package birdseed
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
 	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"math"
+	"net/url"
 	"os"
+	"path"
+	"regexp"
+	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
 	_ "github.com/libsql/libsql-client-go/libsql"
 )
 
@@ -19,6 +35,23 @@ const (
 	layoutISO = "2006-01-02"
 	layoutUS  = "01/02/2006"
 	DSN       = "DSN"
+	dataDir   = "../data/"
+	envFile   = "../.env"
+
+	// layoutTimestamp and layoutTimestampMinute are the accepted layouts of intraday timestamps
+	layoutTimestamp       = "2006-01-02 15:04:05"
+	layoutTimestampMinute = "2006-01-02 15:04"
+
+	// layoutFilename is the date layout used in the filename of universe dumps, e.g. export_20240409.csv
+	layoutFilename = "20060102"
+)
+
+var (
+	filenameDate = regexp.MustCompile(`_(\d{8})$`)
+	isoWeekDate  = regexp.MustCompile(`^(\d{4})-W(\d{2})$`)
+	// tickerPattern matches the upper cased tickers taken from file names, including class
+	// shares such as BRK.B and listings such as RDS-A
+	tickerPattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9.-]{0,19}$`)
 )
 
 // Candle is a single candle of a time series
@@ -32,175 +65,1748 @@ type Candle struct {
 	High   float64
 	Low    float64
 	Volume int64
+
+	// AdjClose is the split and dividend adjusted close, the raw close when the file has none
+	AdjClose float64
+
+	// Return is the daily return from the previous close of the ticker, nil for the first candle
+	Return *float64
+
+	// Source is the name of the file the candle was read from
+	Source string
+	// Row is the 1-based line of the candle in its file, or its entry in a JSON file
+	Row int
+	// Interval is the timeframe of the candle given by -interval, e.g. daily or 1h, empty when not stored
+	Interval string
+	// Intraday is set when the date was parsed from a timestamp rather than a calendar date, in
+	// which case the full timestamp is stored and used as the key of the candle
+	Intraday bool
+}
+
+// Equal reports whether two candles describe the same ticker and date with prices and volume
+// within tol of each other. ID is not compared as it is assigned by the database.
+func (c Candle) Equal(o Candle, tol float64) bool {
+	// Dates are compared as stored, as daily dates read in -tz are stored as the same calendar day
+	if c.Ticker != o.Ticker || c.storedDate() != o.storedDate() {
+		return false
+	}
+
+	return within(c.Open, o.Open, tol) &&
+		within(c.Close, o.Close, tol) &&
+		within(c.High, o.High, tol) &&
+		within(c.Low, o.Low, tol) &&
+		within(float64(c.Volume), float64(o.Volume), tol)
+}
+
+// MarshalJSON encodes the candle with its date in stored form. ID is left out as candles are
+// only encoded before they are stored.
+func (c Candle) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Ticker   string   `json:"ticker"`
+		Date     string   `json:"date"`
+		Open     float64  `json:"open"`
+		High     float64  `json:"high"`
+		Low      float64  `json:"low"`
+		Close    float64  `json:"close"`
+		AdjClose float64  `json:"adj_close"`
+		Volume   int64    `json:"volume"`
+		Return   *float64 `json:"return,omitempty"`
+		Interval string   `json:"interval,omitempty"`
+	}{c.Ticker, c.storedDate(), c.Open, c.High, c.Low, c.Close, c.AdjClose, c.Volume, c.Return, c.Interval})
+}
+
+// storedDate formats the date of the candle for storage. The granularity follows the layout the
+// date was parsed with, so intraday bars keep their time of day, including bars at midnight,
+// and minute bars of the same day never collide on (ticker, date).
+func (c Candle) storedDate() string {
+	if c.Intraday {
+		return c.Date.Format(layoutTimestamp)
+	}
+
+	return c.Date.Format(layoutISO)
+}
+
+func within(a, b, tol float64) bool {
+	return math.Abs(a-b) <= tol
+}
+
+// config holds the command line options for a run
+type config struct {
+	// command is the subcommand to run, seed unless another one is given as the first argument
+	command string
+
+	// universe treats each file as a daily dump of many tickers, where the date is taken from
+	// the filename and the first column of each row holds the ticker instead of the date
+	universe bool
+
+	// maxTotalCandles caps the number of candles aggregated across all files, 0 means no limit
+	maxTotalCandles int
+	// truncateAtLimit cuts the file that reaches maxTotalCandles instead of keeping all of its candles
+	truncateAtLimit bool
+
+	// sourceTZ is the name of the timezone intraday timestamps are given in, sourceLoc the resolved location
+	sourceTZ  string
+	sourceLoc *time.Location
+	// tz is the name of the timezone daily dates are given in, loc the resolved location. Dates are
+	// stored as the calendar day they name in it.
+	tz  string
+	loc *time.Location
+
+	// withSource stores the filename each candle was read from in the source_file column
+	withSource bool
+
+	// percentColumns are the price columns holding percentages (1.5%) or basis points (150bps)
+	percentColumns map[string]bool
+
+	// connectRetries is the number of times to retry connecting to the database, with the delay
+	// between attempts starting at connectRetryDelay and doubling after each attempt
+	connectRetries    int
+	connectRetryDelay time.Duration
+
+	// maxRetries is the number of times a transaction of inserts failing with a transient error is
+	// retried, with the delay between attempts starting at retryDelay and doubling after each attempt
+	maxRetries int
+	retryDelay time.Duration
+
+	// driver is the database driver the DSN is opened with, libsql or postgres
+	driver string
+
+	// logLevel is the least severe level that is logged
+	logLevel slog.Level
+
+	// ensureSchema creates the candles table and its index before seeding if they are missing
+	ensureSchema bool
+	// missingTable decides what happens when the candles table does not exist, either create or error
+	missingTable string
+
+	// weekDay is the day of the week that ISO week dates such as 2024-W15 are stored as
+	weekDay time.Weekday
+
+	// filter keeps only the candles the -filter-expr expression evaluates to true for, nil keeps all
+	filter filterExpr
+
+	// s3 is an s3://bucket/prefix location to read the csv files from instead of the data directory
+	s3 string
+	// s3PathStyle addresses the bucket in the path rather than the host, as needed by e.g. MinIO
+	s3PathStyle bool
+
+	// fileTimings adds the parse and insert durations of the slowest files to the report
+	fileTimings bool
+
+	// coerceOHLC fills blank open, high and low cells with the close price of the row
+	coerceOHLC bool
+
+	// rollup aggregates intraday candles into coarser candles, currently only daily is supported
+	rollup string
+
+	// output is where the aggregated candles are written, the database or a csv file
+	output string
+	// out is the path of the output file when not writing to the database, - for stdout
+	out string
+
+	// requireSortedInput fails files whose dates are not in order as delivered
+	requireSortedInput bool
+	// strictDuplicates fails files holding the same (ticker, date) twice instead of keeping the last row
+	strictDuplicates bool
+
+	// gzipDB compresses the SQLite file written by -output sqlite to <out>.gz, and gzipDBRemove
+	// removes the uncompressed file afterwards
+	gzipDB       bool
+	gzipDBRemove bool
+
+	// requireVolume warns about or fails on zero volume candles, except for volumeExempt tickers
+	// such as crypto pairs which can legitimately trade nothing
+	requireVolume string
+	volumeExempt  map[string]bool
+
+	// interval is the timeframe of the candles being seeded, stored in an interval column and part
+	// of the unique key together with ticker and date. Empty when candles have no interval.
+	interval string
+	// resample aggregates the stored daily candles into weekly or monthly candles instead of seeding
+	resample string
+
+	// withAdjClose stores the adjusted close of every candle in an adj_close column
+	withAdjClose bool
+
+	// withReturns computes the daily return of every candle and stores it in the return column
+	withReturns bool
+
+	// roundPrices is the number of decimals prices are rounded to before storing, -1 keeps
+	// them as parsed. roundingReport lists every price moved by more than roundingTolerance.
+	roundPrices       int
+	roundingReport    bool
+	roundingTolerance float64
+
+	// args holds the positional arguments after the flags, e.g. the two DSNs of diff-db
+	args []string
+	// dryRun parses and checks everything a seed would, printing what would be inserted instead of writing
+	dryRun bool
+	// diff prints what a seed would insert or update compared to the stored candles, without writing
+	diff bool
+	// tolerance is the largest difference between prices or volumes that diff-db and -diff treat as equal
+	tolerance float64
+
+	// parseWorkers files are parsed concurrently. With insertWorkers above zero the candles of
+	// each file are inserted concurrently as soon as it is processed.
+	parseWorkers  int
+	insertWorkers int
+
+	// dataDir is the directory the csv files are read from and envFile the .env file holding the DSN
+	dataDir string
+	envFile string
+	// stdinTicker is the ticker of the single csv stream read from stdin with -data -
+	stdinTicker string
+	// urlTicker is the ticker of the csv file read from an http(s) -data URL, derived from the URL
+	// when empty. httpTimeout bounds fetching the whole file.
+	urlTicker   string
+	httpTimeout time.Duration
+
+	// format is the layout of the csv files. With autodetect it is guessed per file, keeping the
+	// parts that cannot be detected.
+	format     fileFormat
+	autodetect bool
+
+	// skipBadRows logs and skips rows that fail to parse instead of failing their file
+	skipBadRows bool
+
+	// continueOnError skips files that fail to parse, including files that panic, instead of stopping
+	continueOnError bool
+
+	// comment is the character starting comment lines in the csv files, 0 when there are none
+	comment rune
+	// lazyQuotes accepts quotes inside unquoted fields and unescaped quotes inside quoted fields
+	lazyQuotes bool
+
+	// withCreatedAt stores createdAt, the RFC3339 start time of the run, in a created_at column
+	withCreatedAt bool
+	createdAt     string
+
+	// validateFirst parses every file before anything is written and only seeds if all of them parse
+	validateFirst bool
+
+	// retainDays deletes stored candles older than this many days once seeded
+	retainDays int
+
+	// caseInsensitiveTickers stores tickers upper cased and matches stored tickers in any case
+	caseInsensitiveTickers bool
+
+	// startTicker skips every ticker that sorts before it, to resume a seed that failed partway
+	startTicker string
+
+	// rejectNegative fails rows with a negative price, except for negativeExempt tickers such as
+	// futures spreads which can legitimately trade below zero
+	rejectNegative bool
+	negativeExempt map[string]bool
+
+	// verify checks the stored candles of these comma separated tickers for duplicate dates,
+	// out of order rows, missing days and invalid candles instead of seeding. Weekends only count
+	// as missing days with verifyWeekends.
+	verify         string
+	verifyWeekends bool
+
+	// export writes the stored candles of this ticker to -out as csv instead of seeding, limited
+	// to the days from up to and including to when they are set
+	export string
+	from   time.Time
+	to     time.Time
+
+	// jsonSummary prints the summary of the run as JSON instead of the printed report
+	jsonSummary bool
+
+	// webhookURL receives the JSON summary of a seed run, failures to deliver it are only logged
+	webhookURL     string
+	webhookTimeout time.Duration
+
+	// deadLetter stores rows that fail to parse in the candles_errors table instead of aborting
+	deadLetter bool
+
+	// shardByTicker writes one output file per ticker into the -out directory
+	shardByTicker bool
+
+	// insertIgnore inserts every candle with INSERT OR IGNORE, skipping rows whose (ticker, date)
+	// is already stored instead of skipping whole tickers that have data
+	insertIgnore bool
+	// batch is the number of candles inserted per statement and txSize the number of statements
+	// per transaction
+	batch  int
+	txSize int
+	// timeout cancels seeding the database, including in-flight inserts, once it has passed
+	timeout time.Duration
+
+	// upsert inserts every candle and updates the stored values of rows whose (ticker, date) is
+	// already stored, so re-seeding refreshes existing rows and adds new dates
+	upsert bool
+
+	// truncate deletes the stored candles of each seeded ticker in the transaction inserting it,
+	// replacing them instead of skipping tickers that have data. It has to be confirmed with yes
+	// or at a prompt.
+	truncate bool
+	yes      bool
+
+	// expectCounts maps tickers to the number of candles they are expected to have, read from
+	// the -expect-counts file
+	expectCounts map[string]int
+}
+
+// Run runs the command line with the given arguments, not including the program name
+func Run(args []string) error {
+	cfg, err := parseFlags(args)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: cfg.logLevel})))
+
+	src, err := newSource(cfg)
+	if err != nil {
+		return err
+	}
+
+	switch cfg.command {
+	case "seed":
+		if cfg.output != "db" {
+			return writeOutput(src, cfg)
+		}
+	case "shell", "summary":
+	case "preview":
+		return preview(os.Stdout, src, cfg)
+	case "diff-db":
+		return diffDatabases(os.Stdout, cfg)
+	default:
+		return fmt.Errorf("unknown command '%s'", cfg.command)
+	}
+
+	// Load environment variables to get database DSN
+	err = loadEnvironmentVariables(cfg.envFile)
+	if err != nil {
+		return fmt.Errorf("could not load .env file at '%s'. %w", cfg.envFile, err)
+	}
+
+	db, err := connectToDatabase(cfg)
+	if err != nil {
+		return err
+	}
+
+	if cfg.dryRun && cfg.command == "seed" {
+		return dryRun(os.Stdout, db, src, cfg)
+	}
+
+	if cfg.diff && cfg.command == "seed" {
+		return diffSeed(os.Stdout, db, src, cfg)
+	}
+
+	if err := prepareSchema(db, cfg); err != nil {
+		return err
+	}
+
+	if cfg.command == "shell" {
+		return shell(os.Stdin, os.Stdout, db)
+	}
+
+	if cfg.command == "summary" {
+		return summarize(os.Stdout, db)
+	}
+
+	ctx := context.Background()
+	if cfg.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.timeout)
+		defer cancel()
+	}
+
+	if cfg.resample != "" {
+		return resample(ctx, db, cfg)
+	}
+
+	if cfg.export != "" {
+		return exportCandles(db, cfg)
+	}
+
+	if cfg.verify != "" {
+		return verifyTickers(os.Stdout, db, cfg)
+	}
+
+	if cfg.truncate && !cfg.yes {
+		if err := confirmTruncate(os.Stdin, os.Stderr, cfg); err != nil {
+			return err
+		}
+	}
+
+	rep := newReport()
+	err = seedDatabase(ctx, db, src, cfg, rep)
+	if cfg.webhookURL != "" {
+		postReport(cfg, rep.summary(err))
+	}
+	// The JSON summary replaces the printed report, and is written for failed runs as well
+	if cfg.jsonSummary {
+		if encodeErr := json.NewEncoder(os.Stdout).Encode(rep.summary(err)); encodeErr != nil {
+			return encodeErr
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	rep.print(os.Stdout, cfg)
+
+	return nil
+}
+
+// seedDatabase reads the files of src, a directory, S3 prefix, URL or stdin, and seeds their
+// candles into db file by file, recording statistics in rep. The columns of each file are found
+// by its header row or position, and the ticker by its name or, for universe dumps, a column.
+// Once seeded, the bad rows are stored with -dead-letter and old candles pruned with -retain-days.
+func seedDatabase(ctx context.Context, db *sqlx.DB, src source, cfg config, rep *report) error {
+	if cfg.validateFirst {
+		if err := validateFirst(src, cfg); err != nil {
+			return err
+		}
+	}
+
+	if cfg.insertWorkers == 0 && cfg.expectCounts == nil {
+		// The candles of each file are seeded once it has been processed, so no more than a
+		// single file is held in memory
+		if _, err := streamCandles(ctx, db, src, cfg, rep, seeder{ctx, db, cfg, rep}); err != nil {
+			return loadError(err)
+		}
+	} else {
+		// -expect-counts checks every file before anything is seeded, so all candles are held
+		candles, err := aggregateCandlesFromFiles(ctx, db, src, cfg, rep)
+		if err != nil {
+			return loadError(err)
+		}
+
+		// Seed the data into the database, unless -insert-workers already did while parsing
+		if cfg.insertWorkers == 0 {
+			if err := seed(ctx, db, candles, cfg, rep); err != nil {
+				return fmt.Errorf("could not seed data. %w", err)
+			}
+		}
+	}
+
+	if cfg.deadLetter {
+		if err := writeDeadLetters(db, rep.badRows); err != nil {
+			return err
+		}
+	}
+
+	if cfg.retainDays > 0 {
+		if err := pruneCandles(db, time.Now().UTC().AddDate(0, 0, -cfg.retainDays), cfg.interval); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadError wraps an error of reading the files, but returns a failed insert of a sink as is
+func loadError(err error) error {
+	var failed seedError
+	if errors.As(err, &failed) {
+		return err
+	}
+
+	return fmt.Errorf("could not load data from csv files. %w", err)
+}
+
+// pruneCandles deletes every stored candle dated before the cutoff day, for -retain-days. With
+// an interval only the candles of that interval are deleted.
+func pruneCandles(db *sqlx.DB, cutoff time.Time, interval string) error {
+	scope, args := intervalClause(interval)
+	res, err := db.Exec(db.Rebind("DELETE FROM candles WHERE date < ?"+scope), append([]any{cutoff.Format(layoutISO)}, args...)...)
+	if err != nil {
+		return fmt.Errorf("could not delete candles before %s. %w", cutoff.Format(layoutISO), err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	slog.Info("Deleted old candles.", "count", deleted, "before", cutoff.Format(layoutISO))
+
+	return nil
+}
+
+func parseFlags(args []string) (config, error) {
+	cfg := config{command: "seed", format: defaultFormat}
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cfg.command = args[0]
+		args = args[1:]
+	}
+
+	fs := flag.NewFlagSet("birdseed", flag.ContinueOnError)
+	fs.BoolVar(&cfg.universe, "universe", false, "files are daily dumps named <name>_YYYYMMDD.csv with the ticker in the first column")
+	fs.IntVar(&cfg.maxTotalCandles, "max-total-candles", 0, "stop aggregating once this many candles have been collected across all files (0 for no limit)")
+	fs.BoolVar(&cfg.truncateAtLimit, "truncate-at-limit", false, "cut the file that reaches -max-total-candles so exactly that many candles are kept")
+	fs.StringVar(&cfg.tz, "tz", "UTC", "IANA timezone daily dates in the source files are given in, stored as the calendar day they name there")
+	fs.StringVar(&cfg.sourceTZ, "source-tz", "UTC", "IANA timezone of intraday timestamps in the source files, converted to UTC before storing")
+	fs.BoolVar(&cfg.withSource, "with-source", false, "store the originating filename of each candle in a source_file column")
+	fs.StringVar(&cfg.interval, "interval", "", "timeframe of the candles, e.g. daily, weekly or 1h, stored in an interval column so one database holds several")
+	fs.StringVar(&cfg.resample, "resample", "", "aggregate the stored daily candles of every ticker into weekly or monthly candles instead of seeding")
+	fs.BoolVar(&cfg.withAdjClose, "with-adj-close", false, "store the adjusted close of each candle, or the close when a file has none, in an adj_close column")
+	fs.IntVar(&cfg.connectRetries, "connect-retries", 0, "number of times to retry connecting to the database before giving up")
+	fs.DurationVar(&cfg.connectRetryDelay, "connect-retry-delay", time.Second, "delay before the first connection retry, doubled after each attempt")
+	fs.StringVar(&cfg.driver, "driver", "libsql", "database driver of the DSN: libsql or postgres")
+	logLevel := fs.String("log-level", "info", "least severe messages that are logged: debug, info, warn or error")
+	fs.IntVar(&cfg.maxRetries, "max-retries", 3, "number of times to retry a transaction of inserts that failed with a transient error, such as a dropped connection")
+	fs.DurationVar(&cfg.retryDelay, "retry-delay", time.Second, "delay before the first retry of a failed transaction of inserts, doubled after each attempt")
+	fs.BoolVar(&cfg.ensureSchema, "ensure-schema", false, "create the candles table and index with all enabled columns if they do not exist")
+	fs.StringVar(&cfg.missingTable, "missing-table", "create", "what to do when the candles table does not exist: create or error")
+	weekDay := fs.String("week-day", "monday", "day of the week ISO week dates such as 2024-W15 are stored as")
+	filter := fs.String("filter-expr", "", "only seed candles matching the expression, e.g. 'volume > 0 && close >= 10'")
+	fs.StringVar(&cfg.s3, "s3", "", "read the csv files under an s3://bucket/prefix location instead of the data directory")
+	fs.BoolVar(&cfg.s3PathStyle, "s3-path-style", false, "use path style addressing for S3, e.g. for MinIO or other S3 compatible endpoints")
+	fs.BoolVar(&cfg.fileTimings, "report-file-timings", false, "report the parse and insert durations of the slowest files")
+	fs.BoolVar(&cfg.coerceOHLC, "coerce-ohlc", false, "use the close price for blank open, high and low cells instead of failing")
+	fs.StringVar(&cfg.rollup, "rollup", "", "aggregate intraday candles before seeding, daily rolls them up per ticker and day in -source-tz")
+	fs.StringVar(&cfg.output, "output", "db", "where to write the candles: db seeds the database, csv writes a normalized csv, sqlite a standalone SQLite file and ndjson one JSON candle per line as files are parsed to -out")
+	fs.StringVar(&cfg.out, "out", "-", "file to write to when -output is not db, - for stdout")
+	fs.BoolVar(&cfg.requireSortedInput, "require-sorted-input", false, "fail files whose dates are not in ascending or descending order as delivered")
+	fs.BoolVar(&cfg.strictDuplicates, "strict-duplicates", false, "fail files holding the same date of a ticker twice instead of keeping the last row")
+	fs.BoolVar(&cfg.gzipDB, "gzip-db", false, "gzip the SQLite file written by -output sqlite to <out>.gz")
+	fs.BoolVar(&cfg.gzipDBRemove, "gzip-db-remove", false, "remove the uncompressed SQLite file after -gzip-db")
+	fs.StringVar(&cfg.requireVolume, "require-volume", "", "warn or error on candles with zero volume, except for -volume-exempt tickers")
+	volumeExempt := fs.String("volume-exempt", "", "comma separated tickers allowed to have zero volume under -require-volume")
+	fs.BoolVar(&cfg.withReturns, "with-returns", false, "store the daily return from the previous close of each ticker in a return column")
+	fs.IntVar(&cfg.roundPrices, "round-prices", -1, "round prices to this many decimals before storing (-1 to keep them as parsed)")
+	fs.BoolVar(&cfg.roundingReport, "rounding-report", false, "report every price changed by more than -rounding-tolerance by -round-prices")
+	fs.Float64Var(&cfg.roundingTolerance, "rounding-tolerance", 0, "largest change from -round-prices left out of -rounding-report")
+	fs.BoolVar(&cfg.dryRun, "dry-run", false, "parse and check every file against the database without writing, printing how many candles per ticker would be inserted")
+	fs.BoolVar(&cfg.diff, "diff", false, "print the candles a seed would insert or update compared to the database, without writing")
+	fs.Float64Var(&cfg.tolerance, "tolerance", 1e-9, "largest difference between prices or volumes that diff-db and -diff treat as equal")
+	fs.IntVar(&cfg.parseWorkers, "parse-workers", 1, "number of files parsed concurrently")
+	fs.IntVar(&cfg.parseWorkers, "workers", 1, "number of files parsed concurrently, same as -parse-workers")
+	fs.IntVar(&cfg.insertWorkers, "insert-workers", 0, "insert the candles of each file with this many concurrent workers while parsing (0 to insert once every file is read)")
+	fs.StringVar(&cfg.dataDir, "data", dataDir, "directory the csv files are read from, absolute or relative to the working directory")
+	fs.StringVar(&cfg.envFile, "env", envFile, ".env file holding the DSN of the database")
+	fs.StringVar(&cfg.urlTicker, "url-ticker", "", "ticker of the csv file read from an http(s) -data URL, instead of the last segment of the URL")
+	fs.DurationVar(&cfg.httpTimeout, "http-timeout", time.Minute, "timeout for fetching the csv file of an http(s) -data URL")
+	fs.StringVar(&cfg.stdinTicker, "stdin-ticker", "", "read a single csv stream of this ticker from stdin instead of the data directory, same as -data -")
+	fs.BoolVar(&cfg.autodetect, "autodetect", false, "guess the delimiter, header row and date layout of each file from its first lines")
+	fs.BoolVar(&cfg.skipBadRows, "skip-bad-rows", false, "log and skip rows that fail to parse instead of stopping, and report how many were skipped")
+	fs.BoolVar(&cfg.continueOnError, "continue-on-error", false, "skip files that fail to parse and keep seeding the rest")
+	comment := fs.String("comment", "", "skip csv lines starting with this character, e.g. #")
+	delimiter := fs.String("delimiter", ",", "the character separating the csv columns, e.g. ';' or '\\t' for tabs")
+	fs.BoolVar(&cfg.format.decimalComma, "decimal-comma", false, "read numbers with a comma as the decimal mark and dots as thousands separators, e.g. 1.234,5")
+	fs.BoolVar(&cfg.lazyQuotes, "lazy-quotes", false, "accept stray quotes in csv fields instead of failing the file")
+	fs.BoolVar(&cfg.withCreatedAt, "with-created-at", false, "store the start time of the run in a created_at column")
+	fs.BoolVar(&cfg.validateFirst, "validate-first", false, "parse every file before writing anything and only seed if none of them has errors")
+	fs.IntVar(&cfg.retainDays, "retain-days", 0, "after seeding, delete stored candles older than this many days (0 to keep everything)")
+	fs.BoolVar(&cfg.caseInsensitiveTickers, "case-insensitive-tickers", false, "store tickers upper cased and treat tickers that differ only in case as the same")
+	fs.StringVar(&cfg.startTicker, "start-ticker", "", "skip every ticker that sorts before this one, to resume a seed that failed partway")
+	fs.BoolVar(&cfg.rejectNegative, "reject-negative-prices", false, "reject rows with a negative price, except for -negative-exempt tickers")
+	negativeExempt := fs.String("negative-exempt", "", "comma separated tickers allowed to have negative prices under -reject-negative-prices")
+	fs.StringVar(&cfg.export, "export", "", "write the stored candles of this ticker to -out as csv in the import format instead of seeding")
+	fs.StringVar(&cfg.verify, "verify", "", "check the stored candles of these comma separated tickers for duplicate, out of order and missing days and invalid candles instead of seeding")
+	fs.BoolVar(&cfg.verifyWeekends, "verify-weekends", false, "count saturdays and sundays without a candle as missing days in -verify, e.g. for crypto")
+	from := fs.String("from", "", "first day exported by -export or checked by -verify, e.g. 2024-01-02")
+	to := fs.String("to", "", "last day exported by -export or checked by -verify, e.g. 2024-12-31")
+	fs.BoolVar(&cfg.jsonSummary, "json-summary", false, "print the summary of the run as JSON, also when it fails, instead of the text report")
+	fs.StringVar(&cfg.webhookURL, "webhook-url", "", "POST a JSON summary of the seed run to this URL when it finishes")
+	fs.DurationVar(&cfg.webhookTimeout, "webhook-timeout", 10*time.Second, "timeout for the -webhook-url request")
+	fs.BoolVar(&cfg.deadLetter, "dead-letter", false, "store rows that fail to parse in a candles_errors table and keep seeding the rest")
+	fs.BoolVar(&cfg.shardByTicker, "shard-by-ticker", false, "write one file per ticker, named <ticker>.csv, into the -out directory")
+	fs.BoolVar(&cfg.insertIgnore, "insert-ignore", false, "insert with INSERT OR IGNORE so only (ticker, date) rows that are not stored yet are added")
+	fs.IntVar(&cfg.batch, "batch", 50, "number of candles inserted per statement")
+	fs.IntVar(&cfg.txSize, "tx-size", 10, "number of insert statements per transaction")
+	fs.DurationVar(&cfg.timeout, "timeout", 0, "cancel seeding the database, including in-flight inserts, after this long (0 for no limit)")
+	fs.BoolVar(&cfg.upsert, "upsert", false, "update the stored values of (ticker, date) rows that already exist and insert the rest")
+	fs.BoolVar(&cfg.truncate, "truncate", false, "delete the stored candles of each seeded ticker and insert the file in their place, in one transaction per ticker")
+	fs.BoolVar(&cfg.yes, "yes", false, "confirm -truncate without prompting")
+	expectCounts := fs.String("expect-counts", "", "csv file of ticker,count lines; fail when a ticker does not have exactly that many candles")
+	percentColumns := fs.String("percent-columns", "", "comma separated price columns (open,high,low,close) holding percentages or basis points")
+
+	if err := fs.Parse(args); err != nil {
+		return config{}, err
+	}
+	cfg.args = fs.Args()
+
+	if *delimiter == `\t` || *delimiter == "tab" {
+		*delimiter = "\t"
+	}
+	delim := []rune(*delimiter)
+	if len(delim) != 1 || delim[0] == '"' || delim[0] == '\r' || delim[0] == '\n' || delim[0] == utf8.RuneError {
+		return config{}, fmt.Errorf("-delimiter must be a single character other than a quote or newline, got '%s'", *delimiter)
+	}
+	cfg.format.delimiter = delim[0]
+
+	if *comment != "" {
+		r := []rune(*comment)
+		if len(r) != 1 || r[0] == '"' || r[0] == cfg.format.delimiter || r[0] == '\r' || r[0] == '\n' {
+			return config{}, fmt.Errorf("-comment must be a single character other than a quote, the delimiter or newline, got '%s'", *comment)
+		}
+		cfg.comment = r[0]
+	}
+
+	if cfg.withCreatedAt {
+		cfg.createdAt = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	// Tickers from file names are upper cased, so -start-ticker c resumes at the C ticker file
+	cfg.startTicker = strings.ToUpper(strings.TrimSpace(cfg.startTicker))
+
+	if cfg.command == "diff-db" && len(cfg.args) != 2 {
+		return config{}, fmt.Errorf("diff-db expects the DSNs of two databases, got %d arguments", len(cfg.args))
+	}
+
+	if cfg.maxTotalCandles < 0 {
+		return config{}, fmt.Errorf("-max-total-candles must not be negative, got %d", cfg.maxTotalCandles)
+	}
+
+	if cfg.retainDays < 0 {
+		return config{}, fmt.Errorf("-retain-days must not be negative, got %d", cfg.retainDays)
+	}
+
+	if cfg.parseWorkers < 1 {
+		// Name the flag as it was given, -workers being the short form of -parse-workers
+		name := "parse-workers"
+		fs.Visit(func(f *flag.Flag) {
+			if f.Name == "workers" || f.Name == "parse-workers" {
+				name = f.Name
+			}
+		})
+		return config{}, fmt.Errorf("-%s must be at least 1, got %d", name, cfg.parseWorkers)
+	}
+
+	if cfg.insertWorkers < 0 {
+		return config{}, fmt.Errorf("-insert-workers must not be negative, got %d", cfg.insertWorkers)
+	}
+
+	if cfg.connectRetries < 0 {
+		return config{}, fmt.Errorf("-connect-retries must not be negative, got %d", cfg.connectRetries)
+	}
+
+	switch *logLevel {
+	case "debug":
+		cfg.logLevel = slog.LevelDebug
+	case "info":
+		cfg.logLevel = slog.LevelInfo
+	case "warn":
+		cfg.logLevel = slog.LevelWarn
+	case "error":
+		cfg.logLevel = slog.LevelError
+	default:
+		return config{}, fmt.Errorf("-log-level must be debug, info, warn or error, got '%s'", *logLevel)
+	}
+
+	if _, ok := driverSchemes[cfg.driver]; !ok {
+		return config{}, fmt.Errorf("-driver must be libsql or postgres, got '%s'", cfg.driver)
+	}
+
+	if cfg.maxRetries < 0 {
+		return config{}, fmt.Errorf("-max-retries must not be negative, got %d", cfg.maxRetries)
+	}
+
+	if cfg.interval != "" && !validInterval(cfg.interval) {
+		return config{}, fmt.Errorf("-interval must be daily, weekly, monthly or a duration such as 1h, got '%s'", cfg.interval)
+	}
+
+	if cfg.resample != "" {
+		if cfg.resample != "weekly" && cfg.resample != "monthly" {
+			return config{}, fmt.Errorf("-resample must be weekly or monthly, got '%s'", cfg.resample)
+		}
+		if cfg.interval != "" || cfg.insertIgnore || cfg.withAdjClose {
+			return config{}, fmt.Errorf("-resample cannot be combined with -interval, -insert-ignore or -with-adj-close")
+		}
+		// Resampled candles are stored with their interval and replace those of an earlier run
+		cfg.interval = cfg.resample
+		cfg.upsert = true
+	}
+
+	if cfg.rollup != "" && cfg.rollup != "daily" {
+		return config{}, fmt.Errorf("-rollup must be daily, got '%s'", cfg.rollup)
+	}
+
+	if cfg.output != "db" && cfg.output != "csv" && cfg.output != "sqlite" && cfg.output != "ndjson" {
+		return config{}, fmt.Errorf("-output must be db, csv, sqlite or ndjson, got '%s'", cfg.output)
+	}
+
+	if cfg.shardByTicker && (cfg.output != "csv" || cfg.out == "-") {
+		return config{}, fmt.Errorf("-shard-by-ticker requires -output csv and an -out directory")
+	}
+
+	if cfg.output == "sqlite" && cfg.out == "-" {
+		return config{}, fmt.Errorf("-output sqlite requires an -out file")
+	}
+
+	if cfg.roundingReport && cfg.roundPrices < 0 {
+		return config{}, fmt.Errorf("-rounding-report requires -round-prices")
+	}
+
+	if cfg.requireVolume != "" && cfg.requireVolume != "warn" && cfg.requireVolume != "error" {
+		return config{}, fmt.Errorf("-require-volume must be warn or error, got '%s'", cfg.requireVolume)
+	}
+
+	cfg.volumeExempt = tickerSet(*volumeExempt)
+	cfg.negativeExempt = tickerSet(*negativeExempt)
+
+	if cfg.batch < 1 {
+		return config{}, fmt.Errorf("-batch must be at least 1, got %d", cfg.batch)
+	}
+
+	if cfg.txSize < 1 {
+		return config{}, fmt.Errorf("-tx-size must be at least 1, got %d", cfg.txSize)
+	}
+
+	if cfg.insertIgnore && cfg.upsert {
+		return config{}, fmt.Errorf("-insert-ignore and -upsert cannot be combined")
+	}
+
+	if cfg.truncate {
+		if cfg.command != "seed" || cfg.output != "db" {
+			return config{}, fmt.Errorf("-truncate requires the seed command and -output db")
+		}
+		if cfg.insertIgnore || cfg.upsert || cfg.universe || cfg.resample != "" || cfg.export != "" {
+			return config{}, fmt.Errorf("-truncate cannot be combined with -insert-ignore, -upsert, -universe, -resample or -export")
+		}
+	}
+
+	if cfg.deadLetter && cfg.output != "db" {
+		return config{}, fmt.Errorf("-dead-letter requires -output db")
+	}
+
+	if (cfg.gzipDB || cfg.gzipDBRemove) && cfg.output != "sqlite" {
+		return config{}, fmt.Errorf("-gzip-db and -gzip-db-remove require -output sqlite")
+	}
+
+	if cfg.stdinTicker != "" {
+		cfg.dataDir = "-"
+	}
+	if cfg.dataDir == "-" {
+		if cfg.stdinTicker == "" {
+			return config{}, fmt.Errorf("-data - requires -stdin-ticker to name the ticker of the stream")
+		}
+		if cfg.universe {
+			return config{}, fmt.Errorf("-data - cannot be combined with -universe, which reads the date from the filename")
+		}
+		if cfg.validateFirst {
+			return config{}, fmt.Errorf("-data - cannot be combined with -validate-first, stdin can only be read once")
+		}
+	}
+
+	for _, d := range []struct {
+		flag  string
+		value string
+		date  *time.Time
+	}{{"-from", *from, &cfg.from}, {"-to", *to, &cfg.to}} {
+		if d.value == "" {
+			continue
+		}
+		if cfg.export == "" && cfg.verify == "" {
+			return config{}, fmt.Errorf("%s requires -export or -verify", d.flag)
+		}
+		date, err := time.Parse(layoutISO, d.value)
+		if err != nil {
+			return config{}, fmt.Errorf("%s must be a date such as 2024-01-02, got '%s'", d.flag, d.value)
+		}
+		*d.date = date
+	}
+
+	if cfg.verify != "" && (cfg.export != "" || cfg.resample != "" || cfg.truncate) {
+		return config{}, fmt.Errorf("-verify cannot be combined with -export, -resample or -truncate")
+	}
+
+	if cfg.urlTicker != "" && !isURL(cfg.dataDir) {
+		return config{}, fmt.Errorf("-url-ticker requires -data to be an http:// or https:// URL")
+	}
+
+	if cfg.missingTable != "create" && cfg.missingTable != "error" {
+		return config{}, fmt.Errorf("-missing-table must be create or error, got '%s'", cfg.missingTable)
+	}
+
+	loc, err := time.LoadLocation(cfg.sourceTZ)
+	if err != nil {
+		return config{}, fmt.Errorf("unknown -source-tz '%s'. %w", cfg.sourceTZ, err)
+	}
+	cfg.sourceLoc = loc
+
+	if cfg.loc, err = time.LoadLocation(cfg.tz); err != nil {
+		return config{}, fmt.Errorf("unknown -tz '%s'. %w", cfg.tz, err)
+	}
+
+	day, err := parseWeekday(*weekDay)
+	if err != nil {
+		return config{}, err
+	}
+	cfg.weekDay = day
+
+	if *filter != "" {
+		expr, err := parseFilterExpr(*filter)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid -filter-expr. %w", err)
+		}
+		cfg.filter = expr
+	}
+
+	if *expectCounts != "" {
+		// The workers would seed candles before every count has been checked
+		if cfg.insertWorkers > 0 {
+			return config{}, fmt.Errorf("-expect-counts cannot be combined with -insert-workers")
+		}
+
+		expected, err := loadExpectedCounts(*expectCounts)
+		if err != nil {
+			return config{}, err
+		}
+		cfg.expectCounts = expected
+	}
+
+	cfg.percentColumns = map[string]bool{}
+	for _, col := range strings.Split(*percentColumns, ",") {
+		col = strings.ToLower(strings.TrimSpace(col))
+		if col == "" {
+			continue
+		}
+
+		switch col {
+		case "open", "high", "low", "close":
+			cfg.percentColumns[col] = true
+		default:
+			return config{}, fmt.Errorf("unknown -percent-columns column '%s'", col)
+		}
+	}
+
+	return cfg, nil
+}
+
+func loadEnvironmentVariables(path string) error {
+	return godotenv.Load(path)
+}
+
+// connectToDatabase opens and pings the database, retrying with backoff so that a database
+// that is still starting up, e.g. a just started container, has time to become reachable.
+func connectToDatabase(cfg config) (*sqlx.DB, error) {
+	return connectToURL(os.Getenv("DSN"), cfg)
+}
+
+// connectToURL opens the database at url, retrying failed connections with a doubling delay
+func connectToURL(url string, cfg config) (*sqlx.DB, error) {
+	if err := validateDSN(cfg.driver, url); err != nil {
+		return nil, err
+	}
+
+	delay := cfg.connectRetryDelay
+	for attempt := 1; ; attempt++ {
+		db, err := openDatabase(cfg.driver, url)
+		if err == nil || attempt > cfg.connectRetries {
+			return db, err
+		}
+
+		slog.Warn("Could not connect to database. Retrying.", "in", delay, "attempt", attempt, "of", cfg.connectRetries, "err", err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// driverSchemes lists the DSN schemes each database driver accepts
+var driverSchemes = map[string][]string{
+	"libsql":   {"libsql", "https", "http", "wss", "ws"},
+	"postgres": {"postgres", "postgresql"},
+}
+
+// validateDSN checks that the DSN scheme matches the driver, turning what would otherwise be an
+// opaque driver failure, e.g. for a pasted file path, into a targeted error.
+func validateDSN(driver string, dsn string) error {
+	if dsn == "" {
+		return fmt.Errorf("the %s environment variable is not set", DSN)
+	}
+
+	schemes := driverSchemes[driver]
+	expected := strings.Join(schemes, "://, ") + "://"
+
+	u, err := url.Parse(dsn)
+	if err != nil || u.Scheme == "" {
+		return fmt.Errorf("the DSN looks like a file path, but the %s driver expects a URL starting with %s", driver, expected)
+	}
+
+	// libsql only opens file: URLs through a registered sqlite driver
+	if u.Scheme == "file" && driver == "libsql" {
+		if !sqliteDriverRegistered() {
+			return fmt.Errorf("the DSN is a file: URL, but no sqlite driver is available. The %s driver expects a URL starting with %s", driver, expected)
+		}
+		return nil
+	}
+
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("the DSN scheme '%s://' is not supported by the %s driver, expected a URL starting with %s", u.Scheme, driver, expected)
+}
+
+func sqliteDriverRegistered() bool {
+	for _, d := range sql.Drivers() {
+		if d == "sqlite" || d == "sqlite3" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func openDatabase(driver string, url string) (*sqlx.DB, error) {
+	db, err := sqlx.Open(driver, withBusyTimeout(url))
+	if err != nil {
+		return nil, err
+	}
+	slog.Debug("Successfully opened connection to database.")
+
+	// The libsql http driver does not contact the server on Ping, so a trivial query is used
+	// to make sure the database is actually reachable.
+	if _, err := db.Exec("SELECT 1"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not ping database. %w", err)
+	}
+	slog.Debug("Successfully pinged database.")
+
+	return db, nil
+}
+
+// sqliteBusyTimeout is how long a connection to a SQLite file waits for a lock held by another
+// connection, e.g. of a concurrent -insert-workers worker, before failing with SQLITE_BUSY
+const sqliteBusyTimeout = 5000
+
+// withBusyTimeout adds a busy timeout to a file: URL that does not set one itself, as SQLite
+// otherwise fails at once when a second connection has to wait for a write
+func withBusyTimeout(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil || u.Scheme != "file" || strings.Contains(u.RawQuery, "busy_timeout") {
+		return dsn
+	}
+
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+
+	return fmt.Sprintf("%s%s_pragma=busy_timeout(%d)", dsn, sep, sqliteBusyTimeout)
+}
+
+func aggregateCandlesFromFiles(ctx context.Context, db *sqlx.DB, src source, cfg config, rep *report) ([]Candle, error) {
+	// With -insert-workers the candles of each file are inserted as soon as it has been
+	// processed rather than once every file has been read
+	if db != nil && cfg.insertWorkers > 0 {
+		ins := startInserters(ctx, db, cfg, rep)
+		defer ins.close()
+		return streamCandles(ctx, db, src, cfg, rep, ins)
+	}
+
+	return streamCandles(ctx, db, src, cfg, rep, nil)
+}
+
+// streamCandles reads the candles of every file and hands those of each processed file to out,
+// or collects and returns them all when out is nil
+func streamCandles(ctx context.Context, db *sqlx.DB, src source, cfg config, rep *report, out sink) ([]Candle, error) {
+	// read each file and create all candles to be seeded
+	files, err := src.files()
+	if err != nil {
+		return nil, err
+	}
+
+	files = selectFiles(files, cfg)
+
+	done := make(chan struct{})
+	defer close(done)
+	parsed := parseFiles(src, files, cfg, cfg.parseWorkers, done)
+
+	// total counts every aggregated candle, including those already flushed to the database
+	total := 0
+	candles := []Candle{}
+	// last holds the latest candle per ticker for -with-returns
+	last := map[string]Candle{}
+	for p := range parsed {
+		if cfg.maxTotalCandles > 0 && total >= cfg.maxTotalCandles {
+			slog.Info("Reached the candle limit. Skipping remaining files.", "limit", cfg.maxTotalCandles)
+			break
+		}
+
+		if p.err != nil {
+			if !cfg.continueOnError {
+				return nil, p.err
+			}
+
+			slog.Warn("Could not parse file. Skipping.", "file", p.file, "err", p.err)
+			rep.recordFailed(p.file)
+			continue
+		}
+		f, c := p.file, p.candles
+		rep.recordParse(f, p.took)
+		rep.recordBadRows(p.bad)
+
+		if cfg.universe && cfg.startTicker != "" {
+			c = skipTickersBefore(c, cfg.startTicker)
+		}
+
+		// Intraday bars are rolled up first, so they are compared with the stored days by the
+		// day they roll up to
+		if cfg.rollup == "daily" {
+			c = rollupDaily(c, cfg.sourceLoc)
+		}
+
+		// Candles that are already stored are skipped. Universe dumps hold many tickers and are
+		// checked per ticker for the date of the dump. Without a database, or when conflicting
+		// rows are ignored or updated by the insert itself, everything is kept.
+		if cfg.checkExisting() && db != nil {
+			if cfg.universe {
+				c, err = skipExistingUniverseCandles(db, f, c, cfg, rep)
+			} else {
+				c, err = skipStoredCandles(db, f, c, cfg, rep)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if cfg.requireVolume != "" {
+			if err := checkVolume(c, cfg); err != nil {
+				return nil, err
+			}
+		}
+
+		if cfg.withReturns {
+			if db != nil {
+				if err := loadStoredCloses(db, c, last, cfg); err != nil {
+					return nil, err
+				}
+			}
+			computeReturns(c, last)
+		}
+
+		if cfg.filter != nil {
+			c = filterCandles(c, cfg.filter)
+		}
+
+		if cfg.roundPrices >= 0 {
+			rep.recordRounding(roundCandles(c, cfg.roundPrices, cfg.roundingTolerance))
+		}
+
+		if cfg.truncateAtLimit && cfg.maxTotalCandles > 0 && total+len(c) > cfg.maxTotalCandles {
+			c = c[:cfg.maxTotalCandles-total]
+		}
+
+		total += len(c)
+		rep.recordCandles(c)
+
+		if out != nil {
+			if len(c) > 0 {
+				if err := out.send(c); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		candles = append(candles, c...)
+	}
+
+	if out != nil {
+		if err := out.close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.expectCounts != nil {
+		if err := checkExpectedCounts(cfg.expectCounts, rep); err != nil {
+			return nil, err
+		}
+	}
+
+	return candles, nil
+}
+
+// selectFiles returns the files that should be read, skipping files without a ticker and
+// tickers before -start-ticker
+func selectFiles(files []string, cfg config) []string {
+	selected := make([]string, 0, len(files))
+	for _, f := range files {
+		if cfg.universe {
+			selected = append(selected, f)
+			continue
+		}
+
+		ticker, err := tickerFromFilename(f)
+		if err != nil {
+			slog.Warn("Could not derive a ticker from the file name. Skipping.", "file", f, "err", err)
+			continue
+		}
+
+		// Files are read in sorted order, so resuming skips everything before the start ticker
+		if cfg.startTicker != "" && ticker < cfg.startTicker {
+			slog.Info("Ticker is before -start-ticker. Skipping.", "ticker", ticker, "start", cfg.startTicker)
+			continue
+		}
+
+		selected = append(selected, f)
+	}
+
+	return selected
+}
+
+// skipStoredCandles keeps the candles of a ticker file dated after the latest stored candle of
+// the ticker, so a file that gained new dates is appended to rather than skipped or reloaded.
+// A ticker without stored candles is read in full.
+func skipStoredCandles(db *sqlx.DB, s string, c []Candle, cfg config, rep *report) ([]Candle, error) {
+	ticker, err := tickerFromFilename(s)
+	if err != nil {
+		return nil, err
+	}
+	latest, ok, err := latestStoredDate(db, ticker, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		slog.Debug("Inserting data.", "ticker", ticker, "candles", len(c))
+		return c, nil
+	}
+
+	candles := make([]Candle, 0, len(c))
+	for _, candle := range c {
+		if candle.storedDate() > latest {
+			candles = append(candles, candle)
+		}
+	}
+
+	if len(candles) == 0 {
+		slog.Info("Data for ticker already exists. Skipping.", "ticker", ticker)
+		rep.recordSkipped(ticker)
+		return candles, nil
+	}
+
+	slog.Debug("Appending candles newer than the stored data.", "ticker", ticker, "stored", latest, "candles", len(candles))
+	return candles, nil
+}
+
+// skipTickersBefore keeps the candles of a universe dump whose ticker does not sort before start
+func skipTickersBefore(c []Candle, start string) []Candle {
+	candles := make([]Candle, 0, len(c))
+	for _, candle := range c {
+		if candle.Ticker >= start {
+			candles = append(candles, candle)
+		}
+	}
+
+	return candles
+}
+
+// skipExistingUniverseCandles keeps the candles of every ticker in a parsed daily universe dump
+// that has no data for the date of the dump in the database yet.
+func skipExistingUniverseCandles(db *sqlx.DB, s string, c []Candle, cfg config, rep *report) ([]Candle, error) {
+	exists := map[string]bool{}
+	candles := make([]Candle, 0, len(c))
+	for _, candle := range c {
+		skip, checked := exists[candle.Ticker]
+		if !checked {
+			var err error
+			skip, err = candleExists(db, candle, cfg)
+			if err != nil {
+				return nil, err
+			}
+			exists[candle.Ticker] = skip
+
+			if skip {
+				slog.Info("Data for ticker already exists. Skipping.", "ticker", candle.Ticker, "date", candle.storedDate())
+				rep.recordSkipped(candle.Ticker)
+			} else {
+				slog.Debug("Inserting data.", "ticker", candle.Ticker, "file", s)
+			}
+		}
+
+		if !skip {
+			candles = append(candles, candle)
+		}
+	}
+
+	return candles, nil
+}
+
+// checkVolume reports candles with zero volume for tickers that are not exempt, which for
+// equities usually means stale or bad data. Under warn each ticker is logged once.
+func checkVolume(candles []Candle, cfg config) error {
+	zero := map[string][]string{}
+	tickers := []string{}
+	for _, c := range candles {
+		if c.Volume != 0 || cfg.volumeExempt[c.Ticker] {
+			continue
+		}
+
+		if _, ok := zero[c.Ticker]; !ok {
+			tickers = append(tickers, c.Ticker)
+		}
+		zero[c.Ticker] = append(zero[c.Ticker], c.storedDate())
+	}
+
+	for _, ticker := range tickers {
+		dates := zero[ticker]
+		if cfg.requireVolume == "error" {
+			return fmt.Errorf("ticker '%s' has %d candles with zero volume, first on %s", ticker, len(dates), dates[0])
+		}
+		slog.Warn("Ticker has candles with zero volume.", "ticker", ticker, "candles", len(dates), "first", dates[0])
+	}
+
+	return nil
+}
+
+// tickerSet parses a comma separated list of tickers
+func tickerSet(s string) map[string]bool {
+	tickers := map[string]bool{}
+	for _, ticker := range strings.Split(s, ",") {
+		if ticker = strings.TrimSpace(ticker); ticker != "" {
+			tickers[ticker] = true
+		}
+	}
+
+	return tickers
+}
+
+func filterCandles(c []Candle, filter filterExpr) []Candle {
+	kept := c[:0]
+	for _, candle := range c {
+		if filter.eval(candle) {
+			kept = append(kept, candle)
+		}
+	}
+
+	return kept
 }
 
-func main() {
-	if err := run(); err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err)
-		os.Exit(1)
+// latestStoredDate returns the stored date of the most recent candle of a ticker, reporting
+// false if it has none
+func latestStoredDate(db *sqlx.DB, ticker string, cfg config) (string, bool, error) {
+	var latest sql.NullString
+	scope, args := intervalClause(cfg.interval)
+	err := db.Get(&latest, db.Rebind("SELECT MAX(date) FROM candles WHERE "+tickerColumn(cfg)+" = ?"+scope), append([]any{ticker}, args...)...)
+	if err != nil {
+		return "", false, fmt.Errorf("could not check existing data for ticker '%s'. %w", ticker, err)
 	}
+
+	return latest.String, latest.Valid, nil
 }
 
-func run() error {
-	// Load environment variables to get database DSN
-	err := loadEnvironmentVariables()
+func candleExists(db *sqlx.DB, c Candle, cfg config) (bool, error) {
+	var count int64
+	scope, args := intervalClause(cfg.interval)
+	err := db.Get(&count, db.Rebind("SELECT COUNT(1) FROM candles WHERE "+tickerColumn(cfg)+" = ? AND date = ?"+scope), append([]any{c.Ticker, c.storedDate()}, args...)...)
 	if err != nil {
-		return fmt.Errorf("could not load .env file at '../.env'. %w", err)
+		return false, fmt.Errorf("could not check existing data for ticker '%s' on %s. %w", c.Ticker, c.storedDate(), err)
 	}
 
-	db, err := connectToDatabase()
-	if err != nil {
-		return err
+	return count > 0, nil
+}
+
+// checkExisting reports whether tickers and candles that are already stored should be skipped
+// before inserting, which is not needed when the insert itself handles conflicting rows
+func (cfg config) checkExisting() bool {
+	return !cfg.insertIgnore && !cfg.upsert && !cfg.truncate
+}
+
+// intervalClause returns the condition, and its argument, that scopes a query on stored candles
+// to the given interval. Without an interval every stored candle is in scope.
+func intervalClause(interval string) (string, []any) {
+	if interval == "" {
+		return "", nil
 	}
 
-	// Loads .csv files from ../data/ using ticker.csv naming convention
-	// Assumes that the data is in the format of: Date,Close/Last,Volume,Open,High,Low
-	// and that the first row is the header row
-	candles, err := aggregateCandlesFromFiles(db)
-	if err != nil {
-		return fmt.Errorf("could not load data from csv files. %w", err)
+	return " AND interval = ?", []any{interval}
+}
+
+// validInterval reports whether s is a named timeframe or a duration such as 1h or 15m
+func validInterval(s string) bool {
+	switch s {
+	case "daily", "weekly", "monthly":
+		return true
 	}
 
-	// Seed the data into the database
-	err = seed(db, candles)
-	if err != nil {
-		return fmt.Errorf("could not seed data. %w", err)
+	d, err := time.ParseDuration(s)
+	return err == nil && d > 0
+}
+
+// tickerColumn returns the expression stored tickers are compared with. Parsed tickers are upper
+// cased under -case-insensitive-tickers, so tickers stored in another case still match.
+func tickerColumn(cfg config) string {
+	if cfg.caseInsensitiveTickers {
+		return "upper(ticker)"
 	}
 
-	return nil
+	return "ticker"
 }
 
-func loadEnvironmentVariables() error {
-	return godotenv.Load("../.env")
+func seed(ctx context.Context, db *sqlx.DB, c []Candle, cfg config, rep *report) error {
+	if len(c) == 0 {
+		slog.Info("No data to seed.")
+		return nil
+	}
+
+	// Candles are aggregated file by file, so each file is a consecutive run of the slice and
+	// can be inserted on its own to time it.
+	for start := 0; start < len(c); {
+		end := start + 1
+		for end < len(c) && c[end].Source == c[start].Source {
+			end++
+		}
+
+		insertStart := time.Now()
+		insert := bulkInsert
+		if cfg.truncate {
+			insert = replaceCandles
+		}
+		if err := insert(ctx, db, c[start:end], cfg); err != nil {
+			return err
+		}
+		rep.recordInsert(c[start].Source, time.Since(insertStart))
+
+		start = end
+	}
+	slog.Info("Successfully inserted data.", "candles", len(c))
+
+	return nil
 }
 
-func connectToDatabase() (*sqlx.DB, error) {
-	url := os.Getenv("DSN")
+// createCandles parses the named file of the source. A panic while parsing, e.g. from an edge
+// case in a library, is turned into an error for the file rather than ending the run.
+func createCandles(src source, s string, cfg config) (candles []Candle, bad []badRow, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Panic while parsing file.", "file", s, "panic", r, "stack", string(debug.Stack()))
+			candles, bad, err = nil, nil, fmt.Errorf("panic while parsing '%s'. %v", s, r)
+		}
+	}()
+
+	// JSON files are decoded, everything else is read as csv
+	read := readCandles
+	if isJSONFile(s) {
+		read = readJSONCandles
+	}
 
-	db, err := sqlx.Open("libsql", url)
+	// Open the file
+	f, err := src.open(s)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	log.Print("Successfully opened connection to database.")
+	defer f.Close()
 
-	if db.Ping(); err != nil {
-		return nil, fmt.Errorf("could not ping database. %w", err)
+	// Compressed files are decompressed while reading
+	if strings.HasSuffix(s, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not decompress '%s'. %w", s, err)
+		}
+		defer gz.Close()
+
+		return read(gz, s, cfg)
 	}
-	log.Print("Successfully pinged database.")
 
-	return db, err
+	return read(f, s, cfg)
 }
 
-func aggregateCandlesFromFiles(db *sqlx.DB) ([]Candle, error) {
-	// read each file and create all candles to be seeded
-	files, err := os.ReadDir("../data/")
+// badRow is a row that could not be turned into a candle
+type badRow struct {
+	file string
+	// row is the 1-based line of the row in the file, counting the header row
+	row int
+	raw []string
+	err error
+}
+
+// readCandles parses the csv data of the named file into candles. Rows that fail to parse abort
+// the file, unless they are collected as bad rows for the dead letter table.
+func readCandles(r io.Reader, s string, cfg config) ([]Candle, []badRow, error) {
+	ticker, date, err := fileTickerAndDate(s, cfg)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	if cfg.autodetect {
+		br := bufio.NewReaderSize(r, sniffBytes)
+		sample, err := br.Peek(sniffBytes)
+		if err != nil && err != io.EOF {
+			return nil, nil, err
+		}
+		cfg.format = detectFormat(s, sample, err == nil, cfg.format, cfg)
+		r = br
+	}
+
+	// Read the file row by row, so only the candles and not the raw rows of a large file are
+	// held in memory. The record is reused between rows.
+	reader := csv.NewReader(r)
+	reader.Comma = cfg.format.delimiter
+	reader.Comment = cfg.comment
+	reader.LazyQuotes = cfg.lazyQuotes
+	reader.ReuseRecord = true
+	// Rows with too few columns are reported by parseRow, naming the row and its ticker, and
+	// extra columns are ignored
+	reader.FieldsPerRecord = -1
+	// row is the 1-based line the last read row starts on in the file. It is taken from the
+	// reader, so skipped comment and blank lines and quoted line breaks are counted too.
+	row := 0
+	next := func() ([]string, error) {
+		d, err := reader.Read()
+		if err == nil {
+			row, _ = reader.FieldPos(0)
+		}
+		return d, err
+	}
+	d, err := next()
+	if err != nil && err != io.EOF {
+		return nil, nil, fmt.Errorf("could not read '%s'. %w", s, err)
+	}
+
+	// An empty file is usually a truncated download, which is only skipped under -skip-bad-rows
+	if err == io.EOF {
+		if !cfg.skipBadRows {
+			return nil, nil, fmt.Errorf("'%s' is empty", s)
+		}
+		slog.Warn("Skipping empty file.", "file", s)
+		return []Candle{}, []badRow{}, nil
+	}
+
+	// Convert the rows into candles, locating the columns by the names in the csv header row, or
+	// by the number of columns of the first row without one
+	cols := positionalLayout(len(d))
+	if cfg.format.header {
+		if cols, err = headerColumns(s, d, cfg); err != nil {
+			return nil, nil, err
+		}
+
+		if d, err = next(); err == io.EOF {
+			slog.Warn("No data rows for ticker.", "ticker", ticker, "file", s)
+		}
+	}
+	// Detect the date layout from the first row, so a file of US dates does not try the ISO
+	// layout on every row
+	if !cfg.universe && err == nil && len(d) > cols["date"] {
+		if layout, ok := detectDateLayout(d[cols["date"]], cfg); ok {
+			cfg.format.dateLayout = layout
+		}
 	}
 
 	candles := []Candle{}
-	for _, f := range files {
-		// If data with ticker exists, abort.
-		ticker := strings.Split(f.Name(), ".")[0]
-		var count int64
-		err := db.Get(&count, "SELECT COUNT(1) FROM candles WHERE ticker = ?", ticker)
+	bad := []badRow{}
+	for ; err != io.EOF; d, err = next() {
 		if err != nil {
-			log.Printf("ERR: %s", err.Error())
+			return nil, nil, fmt.Errorf("could not read '%s'. %w", s, err)
 		}
-		log.Printf("COUNT: %d", count)
-		if count > 0 {
-			log.Printf("Data for ticker '%s' already exists. Skipping.", ticker)
+
+		candle, err := parseRow(ticker, date, cols, d, cfg)
+		if err != nil {
+			b, err := rejectRow(s, row, d, fmt.Errorf("row %d of '%s'. %w", row, s, err), cfg)
+			if err != nil {
+				return nil, nil, err
+			}
+			bad = append(bad, b)
 			continue
 		}
+		candle.Source = s
+		candle.Row = row
+		candle.Interval = cfg.interval
 
-		log.Printf("Inserting data for '%s'.", ticker)
+		candles = append(candles, candle)
+	}
 
-		c, err := createCandles(f.Name())
-		if err != nil {
-			return nil, err
-		}
+	return finishCandles(s, candles, bad, cfg)
+}
 
-		candles = append(candles, c...)
+// fileTickerAndDate returns what the name of a file says about its candles: the ticker of a
+// ticker file, or the date of a universe dump
+func fileTickerAndDate(s string, cfg config) (string, time.Time, error) {
+	if cfg.universe {
+		date, err := dateFromFilename(s)
+		return "", date, err
 	}
 
-	return candles, nil
+	ticker, err := tickerFromFilename(s)
+	return ticker, time.Time{}, err
 }
 
-func seed(db *sqlx.DB, c []Candle) error {
-	if len(c) == 0 {
-		log.Print("No data to seed.")
-		return nil
+// rejectRow returns the error of a row that failed to parse, aborting its file, unless bad rows
+// are skipped or collected for the dead letter table, in which case it returns the bad row
+func rejectRow(s string, row int, d []string, err error, cfg config) (badRow, error) {
+	if !cfg.deadLetter && !cfg.skipBadRows {
+		return badRow{}, err
+	}
+	if cfg.skipBadRows {
+		slog.Warn("Skipping malformed row.", "err", err)
 	}
 
-	err := bulkInsert(db, c)
+	return badRow{file: s, row: row, raw: append([]string(nil), d...), err: err}, nil
+}
+
+// finishCandles checks the parsed candles of a whole file for duplicate dates and, under
+// -require-sorted-input, their order
+func finishCandles(s string, candles []Candle, bad []badRow, cfg config) ([]Candle, []badRow, error) {
+	candles, duplicates := dropDuplicates(candles)
+	if len(duplicates) > 0 {
+		if cfg.strictDuplicates {
+			return nil, nil, fmt.Errorf("'%s' holds duplicate dates: %s", s, strings.Join(duplicates, ", "))
+		}
+		slog.Warn("Dropping duplicate dates, keeping the last row of each.", "file", s, "dates", strings.Join(duplicates, ", "))
+	}
 
-	if err == nil {
-		log.Print("Successfully inserted data.")
+	if cfg.requireSortedInput {
+		if err := checkSorted(candles); err != nil {
+			return nil, nil, fmt.Errorf("'%s' is not sorted by date. %w", s, err)
+		}
 	}
 
-	return err
+	return candles, bad, nil
 }
 
-func createCandles(s string) ([]Candle, error) {
-	ticker := strings.Split(s, ".")[0]
+// parseRow creates the candle of a single row. Universe dumps take the ticker from the first
+// column and the date from the filename, other files the ticker from the filename.
+func parseRow(ticker string, date time.Time, cols columnIndex, d []string, cfg config) (Candle, error) {
+	// Short rows are rejected before any column is indexed, naming the row rather than panicking
+	if width := cols.width(cfg); len(d) < width {
+		if cfg.universe && len(d) > cols["ticker"] {
+			ticker = strings.TrimSpace(d[cols["ticker"]])
+		}
+		return Candle{}, fmt.Errorf("the row of ticker '%s' has %d columns, expected at least %d: %s", ticker, len(d), width, rawRow(d))
+	}
 
-	// Open the file
-	f, err := os.Open("../data/" + s)
+	var candle Candle
+	var err error
+	if cfg.universe {
+		t := strings.TrimSpace(d[cols["ticker"]])
+		if t == "" {
+			return Candle{}, fmt.Errorf("empty ticker")
+		}
+		candle, err = createCandleAt(normalizeTicker(t, cfg), date, cols, d, cfg)
+	} else {
+		candle, err = createCandle(ticker, cols, d, cfg)
+	}
 	if err != nil {
-		return nil, err
+		return Candle{}, err
 	}
-	defer f.Close()
 
-	// Read the file into a string matrix
-	reader := csv.NewReader(f)
-	data, err := reader.ReadAll()
-	if err != nil {
-		return nil, err
+	if err := validate(candle); err != nil {
+		return Candle{}, err
 	}
 
-	// Convert the data into candles, skipping the csv header row
-	candles := make([]Candle, 0, len(data))
-	for _, d := range data[1:] {
-		candle, err := createCandle(ticker, d)
-		if err != nil {
-			return nil, err
+	return candle, nil
+}
+
+// dropDuplicates removes candles of a (ticker, date) that occurs again later in the slice, keeping
+// the last occurrence, and returns the duplicated tickers and dates in the order they were first seen
+func dropDuplicates(candles []Candle) ([]Candle, []string) {
+	type key struct{ ticker, date string }
+
+	last := map[key]int{}
+	seen := map[key]bool{}
+	duplicates := []string{}
+	for i, c := range candles {
+		k := key{c.Ticker, c.storedDate()}
+		if _, ok := last[k]; ok && !seen[k] {
+			seen[k] = true
+			duplicates = append(duplicates, c.Ticker+" "+k.date)
 		}
+		last[k] = i
+	}
+	if len(duplicates) == 0 {
+		return candles, nil
+	}
 
-		candles = append(candles, candle)
+	kept := make([]Candle, 0, len(last))
+	for i, c := range candles {
+		if last[key{c.Ticker, c.storedDate()}] == i {
+			kept = append(kept, c)
+		}
 	}
 
-	return candles, nil
+	return kept, duplicates
+}
+
+// checkSorted verifies that the candles are in date order as delivered, either oldest or newest
+// first. Dates jumping back and forth usually mean a corrupt or concatenated file.
+func checkSorted(candles []Candle) error {
+	direction := 0
+	for i := 1; i < len(candles); i++ {
+		prev, cur := candles[i-1].Date, candles[i].Date
+
+		step := cur.Compare(prev)
+		if step == 0 {
+			continue
+		}
+		if direction == 0 {
+			direction = step
+			continue
+		}
+
+		if step != direction {
+			return fmt.Errorf("row %d (%s) is out of order after row %d (%s)", candles[i].Row, candles[i].storedDate(), candles[i-1].Row, candles[i-1].storedDate())
+		}
+	}
+
+	return nil
+}
+
+// normalizeTicker upper cases a ticker read from the ticker column of a universe dump under
+// -case-insensitive-tickers, so 'aapl' and 'AAPL' are stored as the same ticker. Tickers taken
+// from file names are always upper cased.
+func normalizeTicker(ticker string, cfg config) string {
+	if cfg.caseInsensitiveTickers {
+		return strings.ToUpper(ticker)
+	}
+
+	return ticker
+}
+
+// tickerFromFilename derives the upper cased ticker from a file name or object key using the
+// ticker.csv naming convention, so 'brk.b.csv' holds BRK.B. Hidden files and names that are not
+// a ticker of letters, digits, dots and dashes are rejected rather than attributed to a ticker.
+func tickerFromFilename(name string) (string, error) {
+	base := path.Base(name)
+	if strings.HasPrefix(base, ".") {
+		return "", fmt.Errorf("'%s' is a hidden file", name)
+	}
+
+	ticker := strings.ToUpper(strings.TrimSpace(stripExtensions(base)))
+	if !tickerPattern.MatchString(ticker) {
+		return "", fmt.Errorf("'%s' is not named after a ticker of letters, digits, dots and dashes", name)
+	}
+
+	return ticker, nil
+}
+
+// stripExtensions removes the file extension from a name, together with a .gz suffix of a
+// compressed file, so 'AAPL.csv.gz' becomes 'AAPL' and 'BRK.B.csv' becomes 'BRK.B'
+func stripExtensions(s string) string {
+	s = strings.TrimSuffix(s, ".gz")
+	return strings.TrimSuffix(s, path.Ext(s))
+}
+
+// dateFromFilename extracts the date from a universe dump filename such as export_20240409.csv
+func dateFromFilename(s string) (time.Time, error) {
+	name := stripExtensions(s)
+
+	m := filenameDate.FindStringSubmatch(name)
+	if m == nil {
+		return time.Time{}, fmt.Errorf("filename '%s' does not end with a _YYYYMMDD date", s)
+	}
+
+	return time.Parse(layoutFilename, m[1])
 }
 
-func createCandle(ticker string, s []string) (Candle, error) {
-	date, err := time.Parse(layoutISO, s[0])
+// createCandle creates a candle for the given ticker from a row, whose columns are located by cols
+func createCandle(ticker string, cols columnIndex, s []string, cfg config) (Candle, error) {
+	date, intraday, err := parseDate(s[cols["date"]], cfg)
 	if err != nil {
 		return Candle{}, err
 	}
 
-	open, err := parse(clean(s[1]))
-	if err != nil {
-		log.Fatal(err)
+	candle, err := createCandleAt(ticker, date, cols, s, cfg)
+	candle.Intraday = intraday
+
+	return candle, err
+}
+
+// parseDate parses a daily date, an ISO week date or an intraday timestamp, reporting whether it
+// was a timestamp. Intraday timestamps are interpreted in the source timezone and converted to
+// UTC, daily dates are read as midnight in the -tz timezone.
+func parseDate(s string, cfg config) (time.Time, bool, error) {
+	// Files with US dates try that layout first, which readCandles detects once per file
+	layouts := []string{layoutISO, layoutUS}
+	if cfg.format.dateLayout == layoutUS {
+		layouts = []string{layoutUS, layoutISO}
+	}
+
+	for _, layout := range layouts {
+		if date, err := time.ParseInLocation(layout, s, cfg.loc); err == nil {
+			return date, false, nil
+		}
+	}
+
+	if m := isoWeekDate.FindStringSubmatch(s); m != nil {
+		date, err := parseISOWeek(m[1], m[2], cfg.weekDay)
+		return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, cfg.loc), false, err
+	}
+
+	for _, layout := range []string{layoutTimestamp, layoutTimestampMinute} {
+		if t, err := time.ParseInLocation(layout, s, cfg.sourceLoc); err == nil {
+			return t.UTC(), true, nil
+		}
+	}
+
+	// RFC 3339 timestamps carry their own offset. Midnight is the day itself, as daily candles
+	// are often exported.
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0 {
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, cfg.loc), false, nil
+		}
+		return t.UTC(), true, nil
+	}
+
+	return time.Time{}, false, fmt.Errorf("could not parse '%s' as a date or timestamp", s)
+}
+
+// parseISOWeek returns the given day of an ISO week, where week 1 is the week containing January 4th
+func parseISOWeek(year string, week string, day time.Weekday) (time.Time, error) {
+	y, _ := strconv.Atoi(year)
+	w, _ := strconv.Atoi(week)
+
+	jan4 := time.Date(y, time.January, 4, 0, 0, 0, 0, time.UTC)
+	monday := jan4.AddDate(0, 0, -((int(jan4.Weekday()) + 6) % 7))
+
+	// ISO weeks start on monday, so sunday is the last day of the week
+	offset := (int(day) + 6) % 7
+	date := monday.AddDate(0, 0, (w-1)*7+offset)
+
+	if isoYear, isoWeek := date.ISOWeek(); w < 1 || isoYear != y || isoWeek != w {
+		return time.Time{}, fmt.Errorf("'%s-W%s' is not a valid ISO week", year, week)
+	}
+
+	return date, nil
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(d.String(), s) {
+			return d, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown -week-day '%s'", s)
+}
+
+// createCandleAt creates a candle for the given ticker and date from the price columns of a row
+func createCandleAt(ticker string, date time.Time, cols columnIndex, s []string, cfg config) (Candle, error) {
+	if cfg.coerceOHLC {
+		s = coerceFromClose(cols, s)
 	}
 
-	high, err := parse(clean(s[2]))
+	open, err := parseValue(s[cols["open"]], cfg.percentColumns["open"], cfg.format.decimalComma)
 	if err != nil {
-		log.Fatal(err)
+		return Candle{}, fmt.Errorf("could not parse the open column of ticker '%s'. %w", ticker, err)
 	}
 
-	low, err := parse(clean(s[3]))
+	high, err := parseValue(s[cols["high"]], cfg.percentColumns["high"], cfg.format.decimalComma)
 	if err != nil {
-		log.Fatal(err)
+		return Candle{}, fmt.Errorf("could not parse the high column of ticker '%s'. %w", ticker, err)
 	}
 
-	close, err := parse(clean(s[4]))
+	low, err := parseValue(s[cols["low"]], cfg.percentColumns["low"], cfg.format.decimalComma)
 	if err != nil {
-		log.Fatal(err)
+		return Candle{}, fmt.Errorf("could not parse the low column of ticker '%s'. %w", ticker, err)
 	}
 
-	volume, err := strconv.ParseInt(s[6], 10, 64)
+	close, err := parseValue(s[cols["close"]], cfg.percentColumns["close"], cfg.format.decimalComma)
 	if err != nil {
-		volume = 0
+		return Candle{}, fmt.Errorf("could not parse the close column of ticker '%s'. %w", ticker, err)
+	}
+
+	// Files without a volume column are stored with a volume of 0, which headerColumns logs
+	var volume int64
+	if i, ok := cols["volume"]; ok {
+		if volume, err = parseVolume(s[i], cfg.format.decimalComma); err != nil {
+			return Candle{}, fmt.Errorf("could not parse the volume column of ticker '%s'. %w", ticker, err)
+		}
+	}
+
+	// Files without an adjusted close, or rows where it is blank, fall back to the raw close
+	adjClose := close
+	if i, ok := cols["adj_close"]; ok && i < len(s) && strings.TrimSpace(s[i]) != "" {
+		adjClose, err = parseValue(s[i], cfg.percentColumns["close"], cfg.format.decimalComma)
+		if err != nil {
+			return Candle{}, fmt.Errorf("could not parse the adj close column of ticker '%s'. %w", ticker, err)
+		}
 	}
 
 	candle := Candle{
@@ -211,13 +1817,113 @@ func createCandle(ticker string, s []string) (Candle, error) {
 		High:   high,
 		Low:    low,
 		Volume: volume,
+
+		AdjClose: adjClose,
+	}
+
+	if cfg.rejectNegative && !cfg.negativeExempt[ticker] {
+		if err := checkNegativePrices(candle); err != nil {
+			return Candle{}, err
+		}
 	}
 
 	return candle, nil
 }
 
-func clean(s string) string {
-	return strings.Replace(s, "$", "", -1)
+// validate checks that the prices of the candle are consistent with each other, i.e. that open
+// and close lie between low and high, and that the volume is not negative
+func validate(c Candle) error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("invalid candle for ticker '%s' on %s, "+format, append([]any{c.Ticker, c.storedDate()}, args...)...)
+	}
+
+	switch {
+	case c.High < c.Low:
+		return invalid("high %g is below low %g", c.High, c.Low)
+	case c.Open < c.Low || c.Open > c.High:
+		return invalid("open %g is outside low %g and high %g", c.Open, c.Low, c.High)
+	case c.Close < c.Low || c.Close > c.High:
+		return invalid("close %g is outside low %g and high %g", c.Close, c.Low, c.High)
+	case c.Volume < 0:
+		return invalid("volume %d is negative", c.Volume)
+	}
+
+	return nil
+}
+
+// checkNegativePrices rejects candles with a negative price, which for most instruments means
+// the value was misread, e.g. accounting parentheses turned into a minus sign
+func checkNegativePrices(c Candle) error {
+	prices := []struct {
+		name  string
+		value float64
+	}{{"open", c.Open}, {"high", c.High}, {"low", c.Low}, {"close", c.Close}}
+
+	for _, p := range prices {
+		if p.value < 0 {
+			return fmt.Errorf("negative %s price %g", p.name, p.value)
+		}
+	}
+
+	return nil
+}
+
+// coerceFromClose returns a copy of the row where blank open, high and low cells are set to the
+// close price, so sparse close-only rows become flat candles. Rows without a close are returned as is.
+func coerceFromClose(cols columnIndex, s []string) []string {
+	close := s[cols["close"]]
+	if strings.TrimSpace(close) == "" {
+		return s
+	}
+
+	row := append([]string(nil), s...)
+	for _, field := range []string{"open", "high", "low"} {
+		if i := cols[field]; strings.TrimSpace(row[i]) == "" {
+			row[i] = close
+		}
+	}
+
+	return row
+}
+
+// parseVolume parses a volume such as '1234', '1,234' or '1234.0', truncating any fraction.
+// Unlike prices a blank volume is an error, as it usually means a corrupt download. With
+// decimalComma the separators are the other way around, as in '1.234' or '1234,0'.
+func parseVolume(s string, decimalComma bool) (int64, error) {
+	s = strings.TrimSpace(s)
+	if decimalComma {
+		s = strings.ReplaceAll(strings.ReplaceAll(s, ".", ""), ",", ".")
+	} else {
+		s = strings.ReplaceAll(s, ",", "")
+	}
+	if s == "" {
+		return 0, fmt.Errorf("empty volume")
+	}
+
+	if volume, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return volume, nil
+	}
+
+	value, err := parse(s)
+	if err != nil {
+		return 0, err
+	}
+	if value > math.MaxInt64 || value < math.MinInt64 {
+		return 0, fmt.Errorf("volume '%s' is out of range", s)
+	}
+
+	return int64(value), nil
+}
+
+// clean removes currency signs from a price. With decimalComma it also removes the dots
+// separating thousands and turns the decimal comma into a point, so '1.234,5' is 1234.5.
+func clean(s string, decimalComma bool) string {
+	s = strings.Replace(s, "$", "", -1)
+	if decimalComma {
+		s = strings.Replace(strings.Replace(s, ".", "", -1), ",", ".", -1)
+	}
+
+	return s
 }
 
 func parse(s string) (float64, error) {
@@ -226,53 +1932,171 @@ func parse(s string) (float64, error) {
 		return 0, err
 	}
 
+	// ParseFloat accepts values such as NaN and Inf, which vendors use as sentinels but which
+	// break downstream math and comparisons in SQL.
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("'%s' is not a finite number", s)
+	}
+
 	return value, nil
 }
 
-func bulkInsert(db *sqlx.DB, candles []Candle) error {
-	BUF_LENGTH := 50
-	PARAM_LENGTH := 7
-	INSERTS_PER_TX := 10
+// parseValue parses a price cell, reading it as a percentage or basis points when percent is set
+func parseValue(s string, percent bool, decimalComma bool) (float64, error) {
+	if percent {
+		return parsePercent(clean(s, decimalComma))
+	}
+
+	return parse(clean(s, decimalComma))
+}
+
+// parsePercent parses a percentage such as 1.5% or basis points such as 150bps into a fraction.
+// Values without a suffix are parsed as is.
+func parsePercent(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+
+	divisor := 1.0
+	switch {
+	case strings.HasSuffix(s, "%"):
+		s, divisor = strings.TrimSuffix(s, "%"), 100
+	case strings.HasSuffix(strings.ToLower(s), "bps"):
+		s, divisor = s[:len(s)-len("bps")], 10000
+	}
+
+	value, err := parse(strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+
+	return value / divisor, nil
+}
+
+// bulkInsert inserts the candles in transactions of -tx-size statements of -batch candles each.
+// Transactions that committed before a failing one are kept, so the error tells how many
+// candles were committed and which candles the failing transaction held, for an incremental
+// re-run to pick up from.
+func bulkInsert(ctx context.Context, db *sqlx.DB, candles []Candle, cfg config) error {
+	BUF_LENGTH := cfg.batch
+	PARAM_LENGTH := len(insertColumns(cfg))
+	INSERTS_PER_TX := cfg.txSize
+
+	// committed is the number of candles in committed transactions, which are all before the
+	// candles in values
+	committed := 0
+	failed := func(n int, err error) error {
+		first, last := candles[committed], candles[committed+n-1]
+		return fmt.Errorf("committed %d candles before failure at batch starting %s %s, up to %s %s. %w",
+			committed, first.Ticker, first.storedDate(), last.Ticker, last.storedDate(), err)
+	}
 
 	var values []interface{}
 	for _, c := range candles {
-		values = append(values, c.Date.Format("2006-01-02"), c.Ticker, c.Open, c.High, c.Low, c.Close, c.Volume)
+		values = appendCandleValues(values, c, cfg)
 
 		// Number of values to insert per candle.
 		if len(values) == BUF_LENGTH*PARAM_LENGTH*INSERTS_PER_TX {
-			err := insertNPerTx(db, values, BUF_LENGTH, PARAM_LENGTH, INSERTS_PER_TX)
+			err := insertNPerTx(ctx, db, cfg, values, BUF_LENGTH, PARAM_LENGTH, INSERTS_PER_TX)
 			if err != nil {
-				return err
+				return failed(BUF_LENGTH*INSERTS_PER_TX, err)
 			}
+			committed += BUF_LENGTH * INSERTS_PER_TX
+			slog.Debug("Committed candles.", "ticker", c.Ticker, "through", c.storedDate(), "committed", committed, "of", len(candles))
 			values = values[0:0]
 		}
 	}
 
+	// The remaining candles are inserted in statements of at most -batch candles, so a large
+	// -batch times -tx-size does not end up as one statement with too many variables
+	if full := len(values) / (BUF_LENGTH * PARAM_LENGTH); full > 0 {
+		err := insertNPerTx(ctx, db, cfg, values[:full*BUF_LENGTH*PARAM_LENGTH], BUF_LENGTH, PARAM_LENGTH, full)
+		if err != nil {
+			return failed(full*BUF_LENGTH, err)
+		}
+		committed += full * BUF_LENGTH
+		values = values[full*BUF_LENGTH*PARAM_LENGTH:]
+	}
+
 	if len(values) > 0 {
-		err := insertNPerTx(db, values, len(values)/PARAM_LENGTH, PARAM_LENGTH, 1)
+		err := insertNPerTx(ctx, db, cfg, values, len(values)/PARAM_LENGTH, PARAM_LENGTH, 1)
 		if err != nil {
-			return err
+			return failed(len(values)/PARAM_LENGTH, err)
 		}
 	}
 
 	return nil
 }
 
-func insertNPerTx(db *sqlx.DB, values []interface{}, buf_len int, param_len int, n int) error {
-	tx, err := db.Begin()
+// insertColumns returns the columns written for every candle, in the order bulkInsert appends their values
+func insertColumns(cfg config) []string {
+	columns := []string{"date", "ticker", "open", "high", "low", "close", "volume"}
+	if cfg.withSource {
+		columns = append(columns, "source_file")
+	}
+	if cfg.withAdjClose {
+		columns = append(columns, "adj_close")
+	}
+	if cfg.interval != "" {
+		columns = append(columns, "interval")
+	}
+	if cfg.withReturns {
+		columns = append(columns, "return")
+	}
+	if cfg.withCreatedAt {
+		columns = append(columns, "created_at")
+	}
+
+	return columns
+}
+
+// appendCandleValues appends the values of a candle in the order of insertColumns
+func appendCandleValues(values []interface{}, c Candle, cfg config) []interface{} {
+	values = append(values, c.storedDate(), c.Ticker, c.Open, c.High, c.Low, c.Close, c.Volume)
+	if cfg.withSource {
+		values = append(values, c.Source)
+	}
+	if cfg.withAdjClose {
+		values = append(values, c.AdjClose)
+	}
+	if cfg.interval != "" {
+		values = append(values, c.Interval)
+	}
+	if cfg.withReturns {
+		values = append(values, c.Return)
+	}
+	if cfg.withCreatedAt {
+		values = append(values, cfg.createdAt)
+	}
+
+	return values
+}
+
+// insertNPerTx inserts n statements of buf_len candles in a single transaction. A transaction
+// failing with a transient error is rolled back and retried from the start, up to -max-retries times.
+func insertNPerTx(ctx context.Context, db *sqlx.DB, cfg config, values []interface{}, buf_len int, param_len int, n int) error {
+	// Every candle starts with its date and ticker
+	last := (n*buf_len - 1) * param_len
+	return withRetries(ctx, cfg, func() error {
+		return insertTx(ctx, db, cfg, values, buf_len, param_len, n)
+	}, "from", fmt.Sprintf("%s %s", values[1], values[0]), "to", fmt.Sprintf("%s %s", values[last+1], values[last]))
+}
+
+func insertTx(ctx context.Context, db *sqlx.DB, cfg config, values []interface{}, buf_len int, param_len int, n int) error {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	// Nothing of a failed transaction is kept, so a retry starts from a clean slate
+	defer tx.Rollback()
 
-	bufLengthStmt := insertNCandlesStatement(buf_len)
+	bufLengthStmt := insertNCandlesStatement(db, cfg, buf_len)
 
-	stmt, err := tx.Prepare(bufLengthStmt)
+	stmt, err := tx.PrepareContext(ctx, bufLengthStmt)
 	if err != nil {
 		return err
 	}
 
 	for i := 0; i < n; i++ {
-		if _, err := stmt.Exec(values[i*buf_len*param_len : (i+1)*buf_len*param_len]...); err != nil {
+		if _, err := stmt.ExecContext(ctx, values[i*buf_len*param_len:(i+1)*buf_len*param_len]...); err != nil {
 			return err
 		}
 	}
@@ -280,14 +2104,37 @@ func insertNPerTx(db *sqlx.DB, values []interface{}, buf_len int, param_len int,
 	return tx.Commit()
 }
 
-func insertNCandlesStatement(n int) string {
-	buf := bytes.NewBuffer([]byte("INSERT INTO candles (date, ticker, open, high, low, close, volume) VALUES "))
+// insertNCandlesStatement builds the statement inserting n candles, with the placeholders and
+// conflict handling of the dialect of db
+func insertNCandlesStatement(db *sqlx.DB, cfg config, n int) string {
+	columns := insertColumns(cfg)
+
+	verb := "INSERT INTO"
+	if cfg.insertIgnore && !isPostgres(db) {
+		verb = "INSERT OR IGNORE INTO"
+	}
+
+	buf := bytes.NewBuffer([]byte(verb + " candles (" + strings.Join(columns, ", ") + ") VALUES "))
+	row := "(" + strings.TrimSuffix(strings.Repeat("?,", len(columns)), ",") + ")"
 	for i := 0; i < n; i++ {
 		if i > 0 {
 			buf.WriteString(",")
 		}
-		buf.WriteString("(?,?,?,?,?,?,?)")
+		buf.WriteString(row)
+	}
+
+	if cfg.upsert {
+		keys := keyColumns(cfg)
+		updates := []string{}
+		for _, c := range columns {
+			if !slices.Contains(keys, c) {
+				updates = append(updates, c+" = excluded."+c)
+			}
+		}
+		buf.WriteString(" ON CONFLICT (" + strings.Join(keys, ", ") + ") DO UPDATE SET " + strings.Join(updates, ", "))
+	} else if cfg.insertIgnore && isPostgres(db) {
+		buf.WriteString(" ON CONFLICT DO NOTHING")
 	}
 
-	return buf.String()
+	return db.Rebind(buf.String())
 }
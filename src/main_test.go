@@ -0,0 +1,1075 @@
+package birdseed
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// openTestDB opens a fresh SQLite database in a temporary directory
+func openTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	db, err := openDatabase("libsql", "file:"+filepath.Join(t.TempDir(), "candles.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// testConfig parses the command line arguments the way Run does
+func testConfig(t *testing.T, args ...string) config {
+	t.Helper()
+
+	cfg, err := parseFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cfg
+}
+
+// writeDataDir writes the named files into a temporary data directory and returns its path
+func writeDataDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+// countCandles returns the number of stored candles of a ticker
+func countCandles(t *testing.T, db *sqlx.DB, ticker string) int {
+	t.Helper()
+
+	var n int
+	if err := db.Get(&n, "SELECT COUNT(*) FROM candles WHERE ticker = ?", ticker); err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+func TestBulkInsertSplitsTheRemainderIntoBatches(t *testing.T) {
+	db := openTestDB(t)
+	cfg := testConfig(t, "-missing-table", "create", "-batch", "1000", "-tx-size", "10")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	// 6000 candles fill six statements of -batch but not a transaction of -tx-size of them, so
+	// the remainder must not become a single statement of 6000 candles
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	candles := make([]Candle, 6000)
+	for i := range candles {
+		candles[i] = Candle{Ticker: "BIG", Date: start.AddDate(0, 0, i), Open: 1, High: 2, Low: 0.5, Close: 1.5, Volume: 10}
+	}
+
+	if err := bulkInsert(context.Background(), db, candles, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if n := countCandles(t, db, "BIG"); n != len(candles) {
+		t.Errorf("stored %d candles, want %d", n, len(candles))
+	}
+}
+
+func TestDecimalCommaReadsThousandsSeparators(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want float64
+	}{
+		{"1,5", 1.5},
+		{"1.234,5", 1234.5},
+		{"$1.234.567,25", 1234567.25},
+	} {
+		got, err := parseValue(tc.in, false, true)
+		if err != nil {
+			t.Errorf("parseValue(%q) failed: %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("parseValue(%q) = %g, want %g", tc.in, got, tc.want)
+		}
+	}
+
+	volume, err := parseVolume("1.234.567", true)
+	if err != nil || volume != 1234567 {
+		t.Errorf("parseVolume(\"1.234.567\") = %d, %v, want 1234567", volume, err)
+	}
+
+	// Without the flag the default decimal point is unchanged
+	if got, err := parseValue("1234.5", false, false); err != nil || got != 1234.5 {
+		t.Errorf("parseValue(\"1234.5\") = %g, %v, want 1234.5", got, err)
+	}
+}
+
+func TestExpectCountsCannotBeCombinedWithInsertWorkers(t *testing.T) {
+	counts := filepath.Join(t.TempDir(), "counts.csv")
+	if err := os.WriteFile(counts, []byte("AAA,2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := parseFlags([]string{"-expect-counts", counts, "-insert-workers", "2"})
+	if err == nil || !strings.Contains(err.Error(), "-insert-workers") {
+		t.Errorf("expected -expect-counts with -insert-workers to be rejected, got %v", err)
+	}
+}
+
+func TestExpectCountsSeedsNothingOnAMismatch(t *testing.T) {
+	db := openTestDB(t)
+	dir := writeDataDir(t, map[string]string{
+		"AAA.csv": "Date,Close/Last,Volume,Open,High,Low\n01/03/2024,$11,100,$10,$12,$9\n01/02/2024,$10,100,$9,$11,$8\n",
+		"BBB.csv": "Date,Close/Last,Volume,Open,High,Low\n01/02/2024,$20,100,$19,$21,$18\n",
+	})
+	counts := filepath.Join(t.TempDir(), "counts.csv")
+	if err := os.WriteFile(counts, []byte("AAA,2\nBBB,3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig(t, "-data", dir, "-missing-table", "create", "-expect-counts", counts)
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, newReport())
+	if err == nil || !strings.Contains(err.Error(), "BBB: expected 3, got 1") {
+		t.Fatalf("expected a count mismatch for BBB, got %v", err)
+	}
+	if n := countCandles(t, db, "AAA"); n != 0 {
+		t.Errorf("AAA matched its count but %d candles were seeded before BBB was checked", n)
+	}
+}
+
+func TestStreamedInsertFailuresAreNotReportedAsReadErrors(t *testing.T) {
+	db := openTestDB(t)
+	dir := writeDataDir(t, map[string]string{
+		"AAA.csv": "Date,Close/Last,Volume,Open,High,Low\n01/02/2024,$10,100,$9,$11,$8\n",
+	})
+	cfg := testConfig(t, "-data", dir, "-missing-table", "create")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TRIGGER refuse BEFORE INSERT ON candles BEGIN SELECT RAISE(ABORT, 'refused'); END"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, newReport())
+	if err == nil {
+		t.Fatal("expected the insert to fail")
+	}
+	if !strings.HasPrefix(err.Error(), "could not seed data. ") {
+		t.Errorf("expected the seed error as is, got %v", err)
+	}
+}
+
+func TestRowNumbersAreLinesOfTheFile(t *testing.T) {
+	// Lines 1-2 are comments, 3 is the header and 4 a blank line, so the data starts on line 5
+	file := "# exported 2024-01-10\n# prices in USD\nDate,Open,High,Low,Close,Volume\n\n" +
+		"2024-01-02,1,2,1,2,10\n" +
+		"# a note between rows\n" +
+		"2024-01-03,1,2,1,2,10\n" +
+		"2024-01-01,1,2,1,2,10\n" +
+		"2024-01-04,1,2,1,x,10\n"
+
+	_, bad, err := readCandles(strings.NewReader(file), "ABC.csv", testConfig(t, "-comment", "#", "-skip-bad-rows"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bad) != 1 || bad[0].row != 9 {
+		t.Errorf("expected the bad close on line 9, got %+v", bad)
+	}
+
+	_, _, err = readCandles(strings.NewReader(file), "ABC.csv", testConfig(t, "-comment", "#", "-skip-bad-rows", "-require-sorted-input"))
+	if err == nil || !strings.Contains(err.Error(), "row 8 (2024-01-01) is out of order after row 7 (2024-01-03)") {
+		t.Errorf("expected the out of order row to be named by its line, got %v", err)
+	}
+}
+
+func TestStartTickerIsMatchedInUpperCase(t *testing.T) {
+	cfg := testConfig(t, "-start-ticker", " msft")
+	if cfg.startTicker != "MSFT" {
+		t.Fatalf("-start-ticker is %q, want MSFT", cfg.startTicker)
+	}
+
+	files := selectFiles([]string{"AAPL.csv", "msft.csv", "NVDA.csv"}, cfg)
+	if got := strings.Join(files, ","); got != "msft.csv,NVDA.csv" {
+		t.Errorf("selected %s, want msft.csv,NVDA.csv", got)
+	}
+
+	// A universe dump holds every ticker in one file, so its candles are skipped instead
+	kept := skipTickersBefore([]Candle{{Ticker: "AAPL"}, {Ticker: "MSFT"}, {Ticker: "NVDA"}}, cfg.startTicker)
+	if len(kept) != 2 || kept[0].Ticker != "MSFT" {
+		t.Errorf("kept %+v, want MSFT and NVDA", kept)
+	}
+}
+
+func TestWorkerCountErrorsNameTheFlagGiven(t *testing.T) {
+	for _, flag := range []string{"-workers", "-parse-workers"} {
+		_, err := parseFlags([]string{flag, "0"})
+		if err == nil || err.Error() != flag+" must be at least 1, got 0" {
+			t.Errorf("%s 0 failed with %v", flag, err)
+		}
+	}
+}
+
+func TestUniverseDumpSeedsEveryTickerOfTheFile(t *testing.T) {
+	db := openTestDB(t)
+	dir := writeDataDir(t, map[string]string{
+		"export_20240409.csv": "Symbol,Open,High,Low,Close,Volume\n" +
+			"AAPL,168.5,169.9,168.2,169.7,4200\n" +
+			"MSFT,424.1,426.0,423.5,425.3,1800\n" +
+			"NVDA,870.0,880.1,864.2,871.3,5100\n",
+	})
+	cfg := testConfig(t, "-data", dir, "-universe", "-missing-table", "create")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	// MSFT already has the day of the dump, which only skips MSFT
+	if err := bulkInsert(context.Background(), db, []Candle{
+		{Ticker: "MSFT", Date: day("2024-04-09"), Open: 1, High: 1, Low: 1, Close: 1, Volume: 1},
+	}, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, newReport()); err != nil {
+		t.Fatal(err)
+	}
+	for ticker, want := range map[string]int{"AAPL": 1, "MSFT": 1, "NVDA": 1} {
+		if n := countCandles(t, db, ticker); n != want {
+			t.Errorf("%s has %d candles, want %d", ticker, n, want)
+		}
+	}
+
+	var close float64
+	if err := db.Get(&close, "SELECT close FROM candles WHERE ticker = 'NVDA' AND date = '2024-04-09'"); err != nil {
+		t.Fatal(err)
+	}
+	if close != 871.3 {
+		t.Errorf("NVDA closed at %g on the date of the file name, want 871.3", close)
+	}
+	if err := db.Get(&close, "SELECT close FROM candles WHERE ticker = 'MSFT'"); err != nil || close != 1 {
+		t.Errorf("the stored MSFT candle was overwritten, close is %g (%v)", close, err)
+	}
+}
+
+func TestMaxTotalCandlesCapsTheCandlesOfAllFiles(t *testing.T) {
+	// Three files of four trading days each, read in sorted order
+	files := map[string]string{}
+	for _, ticker := range []string{"AMD", "INTC", "QCOM"} {
+		files[ticker+".csv"] = "Date,Open,High,Low,Close,Volume\n" +
+			"2023-03-01,10,11,9,10.5,500\n2023-03-02,10.5,12,10,11.5,600\n" +
+			"2023-03-03,11.5,12,11,11.75,550\n2023-03-06,11.75,13,11.5,12.5,700\n"
+	}
+	dir := writeDataDir(t, files)
+
+	candles, err := aggregateCandlesFromFiles(context.Background(), nil, dirSource{dir: dir}, testConfig(t, "-data", dir, "-max-total-candles", "6", "-truncate-at-limit"), newReport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candles) != 6 {
+		t.Fatalf("aggregated %d candles, want exactly 6", len(candles))
+	}
+	if last := candles[len(candles)-1]; last.Ticker != "INTC" || last.storedDate() != "2023-03-02" {
+		t.Errorf("the cut ends at %s %s, want INTC 2023-03-02", last.Ticker, last.storedDate())
+	}
+
+	// Without -truncate-at-limit the file reaching the limit is finished and the rest skipped
+	candles, err = aggregateCandlesFromFiles(context.Background(), nil, dirSource{dir: dir}, testConfig(t, "-data", dir, "-max-total-candles", "6"), newReport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candles) != 8 {
+		t.Errorf("aggregated %d candles, want the 8 of AMD and INTC", len(candles))
+	}
+}
+
+func TestCandleEqualToleratesFloatNoise(t *testing.T) {
+	base := Candle{ID: 7, Ticker: "SPY", Date: day("2022-06-01"), Open: 412.1, High: 415.3, Low: 410.9, Close: 413.475, Volume: 81200}
+
+	same := base
+	same.ID = 99
+	if !base.Equal(same, 0) {
+		t.Error("candles differing only in their database id should be equal")
+	}
+
+	noisy := base
+	noisy.Close = 413.4750000001
+	noisy.Low = 410.8999999999
+	if base.Equal(noisy, 0) {
+		t.Error("float noise should break exact equality")
+	}
+	if !base.Equal(noisy, 1e-6) {
+		t.Error("float noise within the tolerance should be equal")
+	}
+
+	for name, change := range map[string]func(*Candle){
+		"open":   func(c *Candle) { c.Open += 0.01 },
+		"volume": func(c *Candle) { c.Volume++ },
+		"ticker": func(c *Candle) { c.Ticker = "SPX" },
+		"date":   func(c *Candle) { c.Date = c.Date.AddDate(0, 0, 1) },
+	} {
+		other := base
+		change(&other)
+		if base.Equal(other, 1e-6) {
+			t.Errorf("a different %s should not be within the tolerance", name)
+		}
+	}
+}
+
+func TestSourceTimezoneConvertsIntradayTimestampsToUTC(t *testing.T) {
+	file := "Datetime,Open,High,Low,Close,Volume\n2024-03-01 09:30:00,180.1,180.9,179.8,180.5,12000\n2024-07-01 09:30:00,210,211,209,210.5,9000\n"
+
+	candles, _, err := readCandles(strings.NewReader(file), "AAPL.csv", testConfig(t, "-source-tz", "America/New_York"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The opening bell is 14:30 UTC in winter and 13:30 UTC under daylight saving time
+	for i, want := range []string{"2024-03-01 14:30:00", "2024-07-01 13:30:00"} {
+		if got := candles[i].storedDate(); got != want {
+			t.Errorf("candle %d is stored at %s, want %s", i, got, want)
+		}
+		if candles[i].Date.Location() != time.UTC {
+			t.Errorf("candle %d is in %s, want UTC", i, candles[i].Date.Location())
+		}
+	}
+}
+
+func TestWithSourceStoresTheOriginatingFile(t *testing.T) {
+	db := openTestDB(t)
+	dir := writeDataDir(t, map[string]string{
+		"GLD.csv": "Date,Open,High,Low,Close,Volume\n2021-11-01,167.2,168,166.9,167.6,7100\n",
+		"SLV.csv": "Date,Open,High,Low,Close,Volume\n2021-11-01,22.1,22.4,21.9,22.3,19000\n2021-11-02,22.3,22.5,22,22.2,17500\n",
+	})
+	cfg := testConfig(t, "-data", dir, "-missing-table", "create", "-with-source")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, newReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := []struct {
+		Ticker string `db:"ticker"`
+		Source string `db:"source_file"`
+	}{}
+	if err := db.Select(&rows, "SELECT ticker, source_file FROM candles ORDER BY ticker, date"); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("stored %d candles, want 3", len(rows))
+	}
+	for _, r := range rows {
+		if r.Source != r.Ticker+".csv" {
+			t.Errorf("candle of %s came from %q, want %s.csv", r.Ticker, r.Source, r.Ticker)
+		}
+	}
+}
+
+func TestPercentColumnsReadPercentagesAndBasisPoints(t *testing.T) {
+	for _, in := range []string{"1.5%", "150bps", "150BPS"} {
+		got, err := parseValue(in, true, false)
+		if err != nil {
+			t.Errorf("parseValue(%q) failed: %v", in, err)
+			continue
+		}
+		if math.Abs(got-0.015) > 1e-12 {
+			t.Errorf("parseValue(%q) = %g, want 0.015", in, got)
+		}
+	}
+
+	// A spread series mixing both notations, with the volume left as is
+	file := "Date,Open,High,Low,Close,Volume\n2024-02-01,1.4%,160bps,1.25%,150bps,300\n"
+	candles, _, err := readCandles(strings.NewReader(file), "SPREAD.csv", testConfig(t, "-percent-columns", "open,high,low,close"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := candles[0]; math.Abs(c.Open-0.014) > 1e-12 || math.Abs(c.Close-0.015) > 1e-12 || c.Volume != 300 {
+		t.Errorf("read open %g, close %g and volume %d, want 0.014, 0.015 and 300", c.Open, c.Close, c.Volume)
+	}
+
+	if _, _, err := readCandles(strings.NewReader(file), "SPREAD.csv", testConfig(t)); err == nil {
+		t.Error("percentages outside -percent-columns should fail to parse")
+	}
+}
+
+// flakyDriver is a database driver refusing the first failures connections, like a database
+// container that is still starting up
+type flakyDriver struct {
+	failures int
+	attempts int
+}
+
+func (d *flakyDriver) Open(string) (driver.Conn, error) {
+	d.attempts++
+	if d.attempts <= d.failures {
+		return nil, errors.New("connection refused")
+	}
+
+	return flakyConn{}, nil
+}
+
+type flakyConn struct{}
+
+func (flakyConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (flakyConn) Close() error                        { return nil }
+func (flakyConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (flakyConn) Exec(string, []driver.Value) (driver.Result, error) {
+	return driver.ResultNoRows, nil
+}
+
+var flaky = &flakyDriver{}
+
+func init() {
+	sql.Register("flaky", flaky)
+}
+
+func TestConnectRetriesUntilTheDatabaseIsUp(t *testing.T) {
+	driverSchemes["flaky"] = []string{"flaky"}
+	t.Cleanup(func() { delete(driverSchemes, "flaky") })
+
+	cfg := testConfig(t, "-connect-retries", "3", "-connect-retry-delay", "1ms")
+	cfg.driver = "flaky"
+
+	*flaky = flakyDriver{failures: 2}
+	db, err := connectToURL("flaky://db", cfg)
+	if err != nil {
+		t.Fatalf("expected the third attempt to connect, got %v", err)
+	}
+	db.Close()
+	if flaky.attempts != 3 {
+		t.Errorf("connected after %d attempts, want 3", flaky.attempts)
+	}
+
+	// Without retries the first refused connection is returned
+	*flaky = flakyDriver{failures: 2}
+	cfg.connectRetries = 0
+	if _, err := connectToURL("flaky://db", cfg); err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("expected the refused connection, got %v", err)
+	}
+}
+
+func TestISOWeekDatesAreStoredAsTheirMonday(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		args []string
+		want string
+	}{
+		{"2024-W15", nil, "2024-04-08"},
+		// Week 1 of 2021 starts in january, week 53 of 2020 ends in it
+		{"2021-W01", nil, "2021-01-04"},
+		{"2020-W53", nil, "2020-12-28"},
+		{"2024-W15", []string{"-week-day", "friday"}, "2024-04-12"},
+		{"2024-W15", []string{"-week-day", "sunday"}, "2024-04-14"},
+	} {
+		date, intraday, err := parseDate(tc.in, testConfig(t, tc.args...))
+		if err != nil {
+			t.Errorf("parseDate(%q) failed: %v", tc.in, err)
+			continue
+		}
+		if got := date.Format(layoutISO); got != tc.want || intraday {
+			t.Errorf("parseDate(%q) with %v = %s (intraday %v), want %s", tc.in, tc.args, got, intraday, tc.want)
+		}
+	}
+
+	if _, _, err := parseDate("2021-W53", testConfig(t)); err == nil {
+		t.Error("2021 has no week 53")
+	}
+}
+
+func TestMinuteBarsOfTheSameDayDoNotCollide(t *testing.T) {
+	db := openTestDB(t)
+	dir := writeDataDir(t, map[string]string{
+		"ES.csv": "Timestamp,Open,High,Low,Close,Volume\n" +
+			"2024-06-03 00:00,5310.25,5311,5309.5,5310.75,812\n" +
+			"2024-06-03 14:31,5290,5292.5,5289.75,5291.25,4021\n" +
+			"2024-06-03 14:32,5291.25,5291.5,5288,5288.5,3766\n",
+	})
+	cfg := testConfig(t, "-data", dir, "-missing-table", "create", "-insert-ignore")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, newReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	dates := []string{}
+	if err := db.Select(&dates, "SELECT date FROM candles WHERE ticker = 'ES' ORDER BY date"); err != nil {
+		t.Fatal(err)
+	}
+	// The midnight bar keeps its time of day too, so it is not mistaken for a daily candle
+	want := "2024-06-03 00:00:00,2024-06-03 14:31:00,2024-06-03 14:32:00"
+	if got := strings.Join(dates, ","); got != want {
+		t.Errorf("stored %s, want %s", got, want)
+	}
+}
+
+func TestCoerceOHLCTurnsCloseOnlyRowsIntoFlatCandles(t *testing.T) {
+	file := "Date,Open,High,Low,Close,Volume\n" +
+		"2023-09-01,101.5,102,100.8,101.2,900\n" +
+		"2023-09-04,,,,101.9,0\n" +
+		"2023-09-05,,,,,0\n"
+
+	// Without the flag the blank prices fail the row
+	if _, _, err := readCandles(strings.NewReader(file), "BOND.csv", testConfig(t)); err == nil {
+		t.Fatal("expected blank prices to fail without -coerce-ohlc")
+	}
+
+	candles, bad, err := readCandles(strings.NewReader(file), "BOND.csv", testConfig(t, "-coerce-ohlc", "-skip-bad-rows"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candles) != 2 {
+		t.Fatalf("read %d candles, want 2", len(candles))
+	}
+	if c := candles[1]; c.Open != 101.9 || c.High != 101.9 || c.Low != 101.9 || c.Close != 101.9 {
+		t.Errorf("the close only row became %s, want a flat candle at 101.9", formatCandle(c))
+	}
+	// A row without even a close is still malformed
+	if len(bad) != 1 || bad[0].row != 4 {
+		t.Errorf("expected the row without a close on line 4 to be rejected, got %+v", bad)
+	}
+}
+
+func TestValidateDSNRejectsSchemesOfTheOtherDriver(t *testing.T) {
+	for _, tc := range []struct {
+		driver, dsn, want string
+	}{
+		{"libsql", "postgres://user@localhost/candles", "'postgres://' is not supported by the libsql driver"},
+		{"libsql", "/var/lib/candles.db", "looks like a file path"},
+		{"postgres", "libsql://candles.turso.io", "'libsql://' is not supported by the postgres driver"},
+		{"postgres", "file:candles.db", "'file://' is not supported by the postgres driver"},
+	} {
+		err := validateDSN(tc.driver, tc.dsn)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("validateDSN(%s, %s) = %v, want an error containing %q", tc.driver, tc.dsn, err, tc.want)
+		}
+	}
+
+	for driver, dsn := range map[string]string{
+		"libsql":   "https://candles.turso.io",
+		"postgres": "postgresql://user@localhost:5432/candles",
+	} {
+		if err := validateDSN(driver, dsn); err != nil {
+			t.Errorf("validateDSN(%s, %s) failed: %v", driver, dsn, err)
+		}
+	}
+}
+
+func TestNonFiniteNumbersAreRejected(t *testing.T) {
+	for _, in := range []string{"NaN", "nan", "Inf", "+Inf", "-inf", "infinity", "1e400"} {
+		if v, err := parse(in); err == nil {
+			t.Errorf("parse(%q) = %g, want an error", in, v)
+		}
+	}
+
+	// A vendor sentinel in a price column fails the row
+	file := "Date,Open,High,Low,Close,Volume\n2022-10-03,12.1,12.4,11.9,NaN,5000\n"
+	_, bad, err := readCandles(strings.NewReader(file), "VNDR.csv", testConfig(t, "-skip-bad-rows"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bad) != 1 || !strings.Contains(bad[0].err.Error(), "'NaN' is not a finite number") {
+		t.Errorf("expected the NaN close to be rejected, got %+v", bad)
+	}
+}
+
+func TestInsertIgnoreAppendsOnlyNewDays(t *testing.T) {
+	db := openTestDB(t)
+	first := writeDataDir(t, map[string]string{
+		"V.csv": "Date,Open,High,Low,Close,Volume\n2020-03-02,174,181,172,180.5,12000000\n2020-03-03,181,183.4,173.2,175,14000000\n",
+	})
+	cfg := testConfig(t, "-data", first, "-missing-table", "create")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := seedDatabase(context.Background(), db, dirSource{dir: first}, cfg, newReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The overlapping day has been revised in the new file, but the stored row is kept
+	second := writeDataDir(t, map[string]string{
+		"V.csv": "Date,Open,High,Low,Close,Volume\n2020-03-03,181,183.4,173.2,177.7,1\n2020-03-04,176,184,175.1,183.9,11000000\n",
+	})
+	cfg = testConfig(t, "-data", second, "-insert-ignore")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := seedDatabase(context.Background(), db, dirSource{dir: second}, cfg, newReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := countCandles(t, db, "V"); n != 3 {
+		t.Errorf("stored %d candles, want 3", n)
+	}
+	var close float64
+	if err := db.Get(&close, "SELECT close FROM candles WHERE ticker = 'V' AND date = '2020-03-03'"); err != nil {
+		t.Fatal(err)
+	}
+	if close != 175 {
+		t.Errorf("the existing 2020-03-03 close was changed to %g", close)
+	}
+}
+
+func TestRequireSortedInputAcceptsEitherDirection(t *testing.T) {
+	cfg := testConfig(t, "-require-sorted-input")
+	for name, file := range map[string]string{
+		"oldest first": "Date,Open,High,Low,Close\n2024-01-02,1,2,1,2\n2024-01-03,1,2,1,2\n2024-01-04,1,2,1,2\n",
+		"newest first": "Date,Open,High,Low,Close\n2024-01-04,1,2,1,2\n2024-01-03,1,2,1,2\n2024-01-02,1,2,1,2\n",
+	} {
+		if _, _, err := readCandles(strings.NewReader(file), "SORTED.csv", cfg); err != nil {
+			t.Errorf("%s failed: %v", name, err)
+		}
+	}
+
+	// Two concatenated exports restart at an earlier date, which is only an error under the flag
+	concatenated := "Date,Open,High,Low,Close\n2024-01-02,1,2,1,2\n2024-01-03,1,2,1,2\n2023-12-28,1,2,1,2\n2023-12-29,1,2,1,2\n"
+	if _, _, err := readCandles(strings.NewReader(concatenated), "CAT.csv", testConfig(t)); err != nil {
+		t.Errorf("unsorted input failed without -require-sorted-input: %v", err)
+	}
+	_, _, err := readCandles(strings.NewReader(concatenated), "CAT.csv", cfg)
+	if err == nil || !strings.Contains(err.Error(), "'CAT.csv' is not sorted by date. row 4 (2023-12-28) is out of order after row 3 (2024-01-03)") {
+		t.Errorf("expected the concatenated file to fail, got %v", err)
+	}
+}
+
+// captureLogs collects what is logged during the test in a buffer
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	return &logs
+}
+
+func TestFilesWithoutATickerAreSkippedWithAWarning(t *testing.T) {
+	db := openTestDB(t)
+	row := "Date,Open,High,Low,Close,Volume\n2024-01-02,10,11,9,10.5,100\n"
+	dir := writeDataDir(t, map[string]string{".csv": row, " .csv": row, "AMZN.csv": row})
+	cfg := testConfig(t, "-data", dir, "-missing-table", "create")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	logs := captureLogs(t)
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, newReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	tickers, err := storedTickers(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(tickers, ",") != "AMZN" {
+		t.Errorf("stored the tickers %q, want only AMZN", tickers)
+	}
+	for _, f := range []string{`file=.csv`, `file=" .csv"`} {
+		if !strings.Contains(logs.String(), "level=WARN msg=\"Could not derive a ticker from the file name. Skipping.\" "+f) {
+			t.Errorf("no warning about %s in\n%s", f, logs.String())
+		}
+	}
+}
+
+func TestZeroVolumeWarnsForEquitiesButNotExemptCrypto(t *testing.T) {
+	candles := []Candle{
+		{Ticker: "KO", Date: day("2023-07-03"), Volume: 5000000},
+		{Ticker: "KO", Date: day("2023-07-05"), Volume: 0},
+		{Ticker: "ETH-USD", Date: day("2023-07-04"), Volume: 0},
+	}
+
+	logs := captureLogs(t)
+	cfg := testConfig(t, "-require-volume", "warn", "-volume-exempt", "ETH-USD")
+	if err := checkVolume(candles, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), `msg="Ticker has candles with zero volume." ticker=KO candles=1 first=2023-07-05`) {
+		t.Errorf("expected a warning about KO, got\n%s", logs.String())
+	}
+	if strings.Contains(logs.String(), "ETH-USD") {
+		t.Errorf("the exempt crypto pair was warned about:\n%s", logs.String())
+	}
+
+	cfg = testConfig(t, "-require-volume", "error", "-volume-exempt", "ETH-USD")
+	if err := checkVolume(candles, cfg); err == nil || !strings.Contains(err.Error(), "ticker 'KO' has 1 candles with zero volume") {
+		t.Errorf("expected KO to fail under -require-volume error, got %v", err)
+	}
+	if err := checkVolume(candles[2:], cfg); err != nil {
+		t.Errorf("the exempt crypto pair failed: %v", err)
+	}
+}
+
+func TestRejectNegativePricesExceptForExemptSpreads(t *testing.T) {
+	// A calendar spread legitimately trades below zero, the equity close is a misread (0.25)
+	spread := "Date,Open,High,Low,Close,Volume\n2020-04-20,0.5,1,-0.5,-0.25,800\n"
+	equity := "Date,Open,High,Low,Close,Volume\n2020-04-20,0.3,0.3,-0.25,-0.25,12000\n"
+
+	cfg := testConfig(t, "-reject-negative-prices", "-negative-exempt", "CL-SPREAD")
+	if _, _, err := readCandles(strings.NewReader(spread), "CL-SPREAD.csv", cfg); err != nil {
+		t.Errorf("the exempt spread was rejected: %v", err)
+	}
+	_, _, err := readCandles(strings.NewReader(equity), "PENNY.csv", cfg)
+	if err == nil || !strings.Contains(err.Error(), "row 2 of 'PENNY.csv'") || !strings.Contains(err.Error(), "negative low price -0.25") {
+		t.Errorf("expected the negative prices of PENNY to be rejected, got %v", err)
+	}
+
+	if _, _, err := readCandles(strings.NewReader(equity), "PENNY.csv", testConfig(t)); err != nil {
+		t.Errorf("negative prices were rejected without the flag: %v", err)
+	}
+	if err := checkNegativePrices(Candle{Open: 4.1, High: 4.2, Low: 4, Close: -4.15}); err == nil || err.Error() != "negative close price -4.15" {
+		t.Errorf("expected the negative close to be named, got %v", err)
+	}
+}
+
+func TestStartTickerResumesASeedAtTheGivenTicker(t *testing.T) {
+	db := openTestDB(t)
+	row := "Date,Open,High,Low,Close,Volume\n2024-01-02,50,51,49,50.5,1000\n"
+	dir := writeDataDir(t, map[string]string{"A.csv": row, "B.csv": row, "C.csv": row, "D.csv": row})
+	cfg := testConfig(t, "-data", dir, "-missing-table", "create", "-start-ticker", "C")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	rep := newReport()
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, rep); err != nil {
+		t.Fatal(err)
+	}
+
+	tickers, err := storedTickers(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(tickers, ",") != "C,D" {
+		t.Errorf("seeded %v, want only C and D", tickers)
+	}
+	if rep.files != 2 {
+		t.Errorf("parsed %d files, want 2", rep.files)
+	}
+}
+
+func TestCaseInsensitiveTickersSkipATickerStoredInLowerCase(t *testing.T) {
+	db := openTestDB(t)
+	// An earlier seed of a universe dump stored the ticker as it was written in the dump
+	dump := writeDataDir(t, map[string]string{
+		"prices_20230915.csv": "Ticker,Open,High,Low,Close,Volume\naapl,176.5,176.9,174.1,175,109000000\n",
+	})
+	cfg := testConfig(t, "-data", dump, "-universe", "-missing-table", "create")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dump}, cfg, newReport()); err != nil {
+		t.Fatal(err)
+	}
+	if n := countCandles(t, db, "aapl"); n != 1 {
+		t.Fatalf("the dump stored %d candles of aapl, want 1", n)
+	}
+
+	dir := writeDataDir(t, map[string]string{
+		"AAPL.csv": "Date,Open,High,Low,Close,Volume\n2023-09-15,176.5,176.9,174.1,175,109000000\n",
+	})
+	rep := newReport()
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, testConfig(t, "-data", dir, "-case-insensitive-tickers"), rep); err != nil {
+		t.Fatal(err)
+	}
+	if !rep.skipped["AAPL"] {
+		t.Errorf("AAPL was not skipped as already stored, skipped %v", rep.skipped)
+	}
+	if n := countCandles(t, db, "AAPL"); n != 0 {
+		t.Errorf("AAPL was seeded again beside aapl with %d candles", n)
+	}
+
+	// Matched exactly, AAPL is another ticker than aapl
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, testConfig(t, "-data", dir), newReport()); err != nil {
+		t.Fatal(err)
+	}
+	if n := countCandles(t, db, "AAPL"); n != 1 {
+		t.Errorf("without -case-insensitive-tickers AAPL has %d candles, want 1", n)
+	}
+}
+
+func TestRetainDaysKeepsOnlyTheRecentCandles(t *testing.T) {
+	db := openTestDB(t)
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	ago := func(days int) string { return today.AddDate(0, 0, -days).Format(layoutISO) }
+
+	dir := writeDataDir(t, map[string]string{
+		"BTC-USD.csv": "Date,Open,High,Low,Close,Volume\n" +
+			ago(400) + ",27100,27400,26900,27250,15000\n" +
+			ago(31) + ",61200,62000,60800,61900,21000\n" +
+			ago(29) + ",61900,63100,61500,62800,19000\n" +
+			ago(1) + ",64000,64600,63700,64300,17000\n",
+	})
+	cfg := testConfig(t, "-data", dir, "-missing-table", "create", "-retain-days", "30")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	// Candles stored by an earlier seed are pruned as well
+	if err := bulkInsert(context.Background(), db, []Candle{
+		{Ticker: "ETH-USD", Date: today.AddDate(0, 0, -90), Open: 1800, High: 1850, Low: 1790, Close: 1820, Volume: 9000},
+		{Ticker: "ETH-USD", Date: today.AddDate(0, 0, -2), Open: 3100, High: 3150, Low: 3080, Close: 3120, Volume: 8000},
+	}, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, newReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	dates := []string{}
+	if err := db.Select(&dates, "SELECT ticker || ' ' || date FROM candles ORDER BY ticker, date"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"BTC-USD " + ago(29), "BTC-USD " + ago(1), "ETH-USD " + ago(2)}
+	if strings.Join(dates, ",") != strings.Join(want, ",") {
+		t.Errorf("kept %v, want %v", dates, want)
+	}
+}
+
+func TestWithCreatedAtStampsEveryCandleOfARunAlike(t *testing.T) {
+	db := openTestDB(t)
+	dir := writeDataDir(t, map[string]string{
+		"GLD.csv": "Date,Open,High,Low,Close,Volume\n2022-11-01,151.2,152,150.7,151.5,6100000\n2022-11-02,151.6,152.3,149.9,150.1,7400000\n",
+		"SLV.csv": "Date,Open,High,Low,Close,Volume\n2022-11-01,18.9,19.3,18.8,19.1,21000000\n",
+	})
+	before := time.Now().UTC().Truncate(time.Second)
+	cfg := testConfig(t, "-data", dir, "-missing-table", "create", "-with-created-at")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, newReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each file is inserted on its own, yet they share the time of the run
+	stamps := []string{}
+	if err := db.Select(&stamps, "SELECT DISTINCT created_at FROM candles"); err != nil {
+		t.Fatal(err)
+	}
+	if len(stamps) != 1 {
+		t.Fatalf("the run stored %d different created_at values: %v", len(stamps), stamps)
+	}
+	created, err := time.Parse(time.RFC3339, stamps[0])
+	if err != nil {
+		t.Fatalf("created_at %q is not RFC3339. %v", stamps[0], err)
+	}
+	if created.Before(before) || created.After(time.Now()) {
+		t.Errorf("created_at %s is not the time of the run", stamps[0])
+	}
+}
+
+func TestCommentLinesAreIgnored(t *testing.T) {
+	dir := writeDataDir(t, map[string]string{
+		"EURUSD.csv": "#source,broker feed,v2\n" +
+			"Date,Open,High,Low,Close,Volume\n" +
+			"2023-02-01,1.0862,1.0990,1.0846,1.0987,148200\n" +
+			"#gap,2023-02-02,feed outage\n" +
+			"2023-02-03,1.0910,1.0925,1.0795,1.0799,161900\n",
+	})
+
+	candles, bad, err := createCandles(dirSource{dir: dir}, "EURUSD.csv", testConfig(t, "-data", dir, "-comment", "#"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bad) != 0 {
+		t.Errorf("comment lines were read as rows: %+v", bad)
+	}
+	if len(candles) != 2 || candles[0].Close != 1.0987 || candles[1].storedDate() != "2023-02-03" {
+		t.Errorf("parsed %+v, want the candles of 2023-02-01 and 2023-02-03", candles)
+	}
+
+	// Without -comment the metadata line is taken for the header
+	if _, _, err := createCandles(dirSource{dir: dir}, "EURUSD.csv", testConfig(t, "-data", dir)); err == nil {
+		t.Error("expected the file to fail to parse without -comment")
+	}
+}
+
+// panicSource is a directory whose file named poisoned panics when it is read, standing in for
+// an edge case of a library
+type panicSource struct {
+	dirSource
+	poisoned string
+}
+
+func (s panicSource) open(name string) (io.ReadCloser, error) {
+	if name == s.poisoned {
+		return panicReader{}, nil
+	}
+
+	return s.dirSource.open(name)
+}
+
+type panicReader struct{}
+
+func (panicReader) Read([]byte) (int, error) { panic("index out of range [7] with length 7") }
+
+func (panicReader) Close() error { return nil }
+
+func TestPanicWhileParsingOnlySkipsThatFile(t *testing.T) {
+	db := openTestDB(t)
+	row := "Date,Open,High,Low,Close,Volume\n2022-03-01,30.1,30.8,29.7,30.4,880000\n"
+	dir := writeDataDir(t, map[string]string{"F.csv": row, "GM.csv": row, "STLA.csv": row})
+	src := panicSource{dirSource{dir: dir}, "GM.csv"}
+	cfg := testConfig(t, "-data", dir, "-missing-table", "create", "-continue-on-error")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	logs := captureLogs(t)
+	rep := newReport()
+	if err := seedDatabase(context.Background(), db, src, cfg, rep); err != nil {
+		t.Fatalf("the panic ended the run: %v", err)
+	}
+	if strings.Join(rep.failed, ",") != "GM.csv" {
+		t.Errorf("reported %v as failed, want GM.csv", rep.failed)
+	}
+	if countCandles(t, db, "F") != 1 || countCandles(t, db, "STLA") != 1 {
+		t.Error("the files next to the one that panicked were not seeded")
+	}
+	if !strings.Contains(logs.String(), "Panic while parsing file.") || !strings.Contains(logs.String(), "panicReader.Read") {
+		t.Errorf("expected the panic to be logged with its stack, got\n%s", logs.String())
+	}
+
+	// Without -continue-on-error the panic fails the run like any parse error of the file
+	err := seedDatabase(context.Background(), db, src, testConfig(t, "-data", dir), newReport())
+	if err == nil || !strings.Contains(err.Error(), "panic while parsing 'GM.csv'. index out of range") {
+		t.Errorf("expected the panic to be returned as an error, got %v", err)
+	}
+}
+
+func TestUSAndISODatesSeedIdentically(t *testing.T) {
+	// The US date, the ISO date and the rest of each row
+	rows := [][3]string{
+		{"12/29/2023", "2023-12-29", "$192.53,42628800,$193.90,$194.40,$191.73"},
+		{"01/02/2024", "2024-01-02", "$185.64,82488700,$187.15,$188.44,$183.89"},
+		{"01/03/2024", "2024-01-03", "$184.25,58414460,$184.22,$185.88,$183.43"},
+	}
+	us, iso := "Date,Close/Last,Volume,Open,High,Low\n", "Date,Close/Last,Volume,Open,High,Low\n"
+	for _, r := range rows {
+		us += r[0] + "," + r[2] + "\n"
+		iso += r[1] + "," + r[2] + "\n"
+	}
+
+	dbs := []*sqlx.DB{}
+	for _, file := range []string{us, iso} {
+		db := openTestDB(t)
+		dir := writeDataDir(t, map[string]string{"AAPL.csv": file})
+		cfg := testConfig(t, "-data", dir, "-missing-table", "create")
+		if err := prepareSchema(db, cfg); err != nil {
+			t.Fatal(err)
+		}
+		if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, newReport()); err != nil {
+			t.Fatal(err)
+		}
+		dbs = append(dbs, db)
+	}
+
+	var out bytes.Buffer
+	diffs, err := diffCandles(&out, dbs[0], dbs[1], "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diffs != 0 || countCandles(t, dbs[0], "AAPL") != 3 {
+		t.Errorf("the US dated file seeded differently from the ISO dated one:\n%s", out.String())
+	}
+
+	_, _, err = readCandles(strings.NewReader("Date,Close/Last,Volume,Open,High,Low\n2024.01.02,$185.64,82488700,$187.15,$188.44,$183.89\n"), "AAPL.csv", testConfig(t))
+	if err == nil || !strings.Contains(err.Error(), "could not parse '2024.01.02' as a date or timestamp") {
+		t.Errorf("expected the date in neither layout to be named, got %v", err)
+	}
+}
+
+func TestGzippedAndPlainFilesSeedAlike(t *testing.T) {
+	db := openTestDB(t)
+	dir := writeDataDir(t, map[string]string{
+		"MSFT.csv": "Date,Open,High,Low,Close,Volume\n2024-02-01,401.8,408,401.1,403.8,30657700\n2024-02-02,403.8,412.7,403.6,411.2,28245000\n",
+	})
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	if _, err := io.WriteString(zw, "Date,Open,High,Low,Close,Volume\n2024-02-01,391.5,393.2,389.5,392.9,3120000\n2024-02-02,393,401.4,392.6,401.1,4210000\n2024-02-05,400.7,403,399.1,402.7,3650000\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "BRK.B.csv.gz"), gz.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig(t, "-data", dir, "-missing-table", "create")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, newReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both extensions are stripped, and the dot of the class share is kept
+	for ticker, want := range map[string]int{"BRK.B": 3, "MSFT": 2} {
+		if n := countCandles(t, db, ticker); n != want {
+			t.Errorf("%s has %d candles, want %d", ticker, n, want)
+		}
+	}
+	var close float64
+	if err := db.Get(&close, "SELECT close FROM candles WHERE ticker = 'BRK.B' AND date = '2024-02-05'"); err != nil {
+		t.Fatal(err)
+	}
+	if close != 402.7 {
+		t.Errorf("the gzipped close was read as %g, want 402.7", close)
+	}
+}
+
+func TestRetainDaysOnlyPrunesItsOwnInterval(t *testing.T) {
+	db := openTestDB(t)
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	old, recent := today.AddDate(0, 0, -60), today.AddDate(0, 0, -3)
+	dir := writeDataDir(t, map[string]string{
+		"TLT.csv": "Date,Open,High,Low,Close,Volume\n" +
+			old.Format(layoutISO) + ",92.4,92.9,91.8,92.1,21000000\n" +
+			recent.Format(layoutISO) + ",94.6,95.2,94.1,95,19000000\n",
+	})
+	daily := testConfig(t, "-data", dir, "-missing-table", "create", "-interval", "daily", "-retain-days", "30")
+	if err := prepareSchema(db, daily); err != nil {
+		t.Fatal(err)
+	}
+	// Monthly candles of the same ticker are kept for longer than the daily window
+	monthly := testConfig(t, "-interval", "monthly")
+	if err := bulkInsert(context.Background(), db, []Candle{
+		{Ticker: "TLT", Date: today.AddDate(0, -6, 0), Open: 90, High: 96, Low: 88, Close: 94, Volume: 400000000, Interval: "monthly"},
+	}, monthly); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, daily, newReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	kept := []string{}
+	if err := db.Select(&kept, "SELECT interval || ' ' || date FROM candles ORDER BY interval, date"); err != nil {
+		t.Fatal(err)
+	}
+	want := "daily " + recent.Format(layoutISO) + ",monthly " + today.AddDate(0, -6, 0).Format(layoutISO)
+	if strings.Join(kept, ",") != want {
+		t.Errorf("kept %v, want %s", kept, want)
+	}
+}
@@ -0,0 +1,195 @@
+package birdseed
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// csvHeader is the header of normalized csv output. The columns up to Volume are in the order
+// the importer reads them, so a single ticker file can be seeded again as is.
+var csvHeader = []string{"Date", "Open", "High", "Low", "Close", "Adj Close", "Volume", "Ticker"}
+
+// writeOutput aggregates the candles of every file without touching the database and writes
+// them, deduplicated and sorted, to -out in the -output format.
+func writeOutput(src source, cfg config) error {
+	if cfg.output == "ndjson" {
+		return writeNDJSON(src, cfg)
+	}
+
+	candles, err := aggregateCandlesFromFiles(context.Background(), nil, src, cfg, newReport())
+	if err != nil {
+		return fmt.Errorf("could not load data from csv files. %w", err)
+	}
+	candles = normalizeCandles(candles)
+
+	if cfg.output == "sqlite" {
+		return writeSQLite(cfg.out, candles, cfg)
+	}
+
+	if cfg.shardByTicker {
+		return writeShards(candles, cfg)
+	}
+
+	w := io.Writer(os.Stdout)
+	if cfg.out != "-" {
+		f, err := os.Create(cfg.out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := writeCSV(w, candles); err != nil {
+		return fmt.Errorf("could not write %s output. %w", cfg.output, err)
+	}
+
+	return nil
+}
+
+// writeNDJSON streams the candles of each file to -out as newline delimited JSON as soon as the
+// file has been parsed. Unlike the other outputs candles are neither buffered, deduplicated nor sorted.
+func writeNDJSON(src source, cfg config) error {
+	w := io.Writer(os.Stdout)
+	if cfg.out != "-" {
+		f, err := os.Create(cfg.out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	bw := bufio.NewWriter(w)
+	if _, err := streamCandles(context.Background(), nil, src, cfg, newReport(), ndjsonSink{bw, json.NewEncoder(bw)}); err != nil {
+		return fmt.Errorf("could not write ndjson output. %w", err)
+	}
+
+	return nil
+}
+
+// ndjsonSink encodes every candle it receives on its own line
+type ndjsonSink struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (s ndjsonSink) send(candles []Candle) error {
+	for _, c := range candles {
+		if err := s.enc.Encode(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s ndjsonSink) close() error {
+	return s.w.Flush()
+}
+
+// writeShards writes the candles of each ticker into its own <ticker>.csv file in the -out
+// directory, which follows the ticker.csv naming convention of the importer.
+func writeShards(candles []Candle, cfg config) error {
+	if err := os.MkdirAll(cfg.out, 0o755); err != nil {
+		return err
+	}
+
+	// The candles are sorted by ticker, so each ticker is a consecutive run of the slice
+	for start := 0; start < len(candles); {
+		end := start + 1
+		for end < len(candles) && candles[end].Ticker == candles[start].Ticker {
+			end++
+		}
+
+		if err := writeShard(filepath.Join(cfg.out, candles[start].Ticker+".csv"), candles[start:end]); err != nil {
+			return fmt.Errorf("could not write %s output for '%s'. %w", cfg.output, candles[start].Ticker, err)
+		}
+
+		start = end
+	}
+
+	return nil
+}
+
+func writeShard(path string, candles []Candle) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := writeCSV(f, candles); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// normalizeCandles sorts the candles by ticker and date and drops duplicate (ticker, date)
+// pairs, keeping the candle read last.
+func normalizeCandles(candles []Candle) []Candle {
+	type key struct{ ticker, date string }
+
+	last := map[key]int{}
+	for i, c := range candles {
+		last[key{c.Ticker, c.storedDate()}] = i
+	}
+
+	normalized := make([]Candle, 0, len(last))
+	for i, c := range candles {
+		if last[key{c.Ticker, c.storedDate()}] == i {
+			normalized = append(normalized, c)
+		}
+	}
+
+	sort.SliceStable(normalized, func(i, j int) bool {
+		if normalized[i].Ticker != normalized[j].Ticker {
+			return normalized[i].Ticker < normalized[j].Ticker
+		}
+		return normalized[i].Date.Before(normalized[j].Date)
+	})
+
+	return normalized
+}
+
+func writeCSV(w io.Writer, candles []Candle) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, c := range candles {
+		if err := cw.Write(csvRecord(c)); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvRecord(c Candle) []string {
+	return []string{
+		c.storedDate(),
+		formatFloat(c.Open),
+		formatFloat(c.High),
+		formatFloat(c.Low),
+		formatFloat(c.Close),
+		formatFloat(c.AdjClose),
+		strconv.FormatInt(c.Volume, 10),
+		c.Ticker,
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
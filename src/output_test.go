@@ -0,0 +1,144 @@
+package birdseed
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCSVOutputReparsesIntoIdenticalCandles(t *testing.T) {
+	// Newest first, dollar signs, thousands separators and a repeated date
+	dir := writeDataDir(t, map[string]string{
+		"NFLX.csv": "Date,Close/Last,Volume,Open,High,Low\n" +
+			"02/14/2024,$580.56,\"3,398,000\",$583.00,$587.71,$576.03\n" +
+			"02/13/2024,$579.61,\"4,112,500\",$577.50,$584.44,$573.36\n" +
+			"02/13/2024,$579.61,\"4,112,500\",$577.50,$584.44,$573.36\n" +
+			"02/12/2024,$589.46,\"3,000,100\",$585.01,$597.49,$584.22\n",
+	})
+	out := filepath.Join(t.TempDir(), "NFLX.csv")
+	cfg := testConfig(t, "-data", dir, "-output", "csv", "-out", out)
+	if err := writeOutput(dirSource{dir: dir}, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(written), "Date,Open,High,Low,Close,Adj Close,Volume,Ticker\n2024-02-12,585.01,597.49,584.22,589.46,589.46,3000100,NFLX\n") {
+		t.Errorf("the output is not canonical csv:\n%s", written)
+	}
+
+	want, err := aggregateCandlesFromFiles(context.Background(), nil, dirSource{dir: dir}, cfg, newReport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = normalizeCandles(want)
+	got, _, err := createCandles(dirSource{dir: filepath.Dir(out)}, "NFLX.csv", testConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) || len(got) != 3 {
+		t.Fatalf("re-parsed %d candles, want the 3 distinct days", len(got))
+	}
+	for i := range want {
+		if !got[i].Equal(want[i], 0) || got[i].AdjClose != want[i].AdjClose {
+			t.Errorf("candle %d re-parsed as %s, want %s", i, formatCandle(got[i]), formatCandle(want[i]))
+		}
+	}
+}
+
+func TestShardByTickerWritesOneFilePerTicker(t *testing.T) {
+	// Two daily dumps, each holding every ticker
+	dir := writeDataDir(t, map[string]string{
+		"eod_20240102.csv": "Ticker,Open,High,Low,Close,Volume\nJPM,170.1,171.6,169.7,171.3,9200000\nBAC,33.4,33.9,33.2,33.8,41000000\nWFC,49.2,49.9,49,49.7,17000000\n",
+		"eod_20240103.csv": "Ticker,Open,High,Low,Close,Volume\nJPM,171,172,170.2,170.9,8800000\nBAC,33.6,33.7,33,33.1,38500000\n",
+	})
+	out := filepath.Join(t.TempDir(), "shards")
+	if err := writeOutput(dirSource{dir: dir}, testConfig(t, "-data", dir, "-universe", "-output", "csv", "-shard-by-ticker", "-out", out)); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if strings.Join(names, ",") != "BAC.csv,JPM.csv,WFC.csv" {
+		t.Fatalf("wrote %v, want one file per ticker", names)
+	}
+
+	for ticker, want := range map[string]int{"BAC": 2, "JPM": 2, "WFC": 1} {
+		candles, _, err := createCandles(dirSource{dir: out}, ticker+".csv", testConfig(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(candles) != want {
+			t.Errorf("%s.csv holds %d candles, want %d", ticker, len(candles), want)
+		}
+		for _, c := range candles {
+			if c.Ticker != ticker {
+				t.Errorf("%s.csv holds a candle of %s", ticker, c.Ticker)
+			}
+		}
+	}
+}
+
+func TestNDJSONOutputWritesOneCandlePerLine(t *testing.T) {
+	dir := writeDataDir(t, map[string]string{
+		"KO.json": `[{"date": "2021-08-02", "open": 57.1, "high": 57.6, "low": 56.9, "close": 57.3, "volume": 11800000},
+			{"date": "2021-08-03", "open": 57.3, "high": 57.8, "low": 57, "close": 57.7, "volume": 10100000}]`,
+		"PEP.csv": "Date,Open,High,Low,Close,Adj Close,Volume\n" +
+			"2021-08-02,157.2,158.1,156.3,157.9,150.2,3900000\n" +
+			"2021-08-03,158,159.4,157.6,159.1,151.3,4200000\n" +
+			"2021-08-04,159,159.5,157.8,158,150.3,3500000\n",
+	})
+	out := filepath.Join(t.TempDir(), "candles.ndjson")
+	if err := writeOutput(dirSource{dir: dir}, testConfig(t, "-data", dir, "-output", "ndjson", "-out", out)); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tickers := []string{}
+	lines := bufio.NewScanner(f)
+	for lines.Scan() {
+		var c struct {
+			Ticker   string  `json:"ticker"`
+			Date     string  `json:"date"`
+			Open     float64 `json:"open"`
+			High     float64 `json:"high"`
+			Low      float64 `json:"low"`
+			Close    float64 `json:"close"`
+			AdjClose float64 `json:"adj_close"`
+			Volume   int64   `json:"volume"`
+		}
+		dec := json.NewDecoder(strings.NewReader(lines.Text()))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&c); err != nil {
+			t.Fatalf("line %q is not a JSON candle. %v", lines.Text(), err)
+		}
+		if c.Date == "" || c.Close == 0 || c.Volume == 0 {
+			t.Errorf("line %q is missing fields of the candle", lines.Text())
+		}
+		tickers = append(tickers, c.Ticker)
+	}
+	if err := lines.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(tickers, ","); got != "KO,KO,PEP,PEP,PEP" {
+		t.Errorf("wrote candles of %s, want 2 of KO and 3 of PEP in file order", got)
+	}
+}
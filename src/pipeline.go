@@ -0,0 +1,181 @@
+package birdseed
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// parsedFile is the result of parsing a single file in the background
+type parsedFile struct {
+	file    string
+	candles []Candle
+	bad     []badRow
+	took    time.Duration
+	err     error
+}
+
+// parseFiles parses the files with n workers in the background. The results are delivered in
+// the order of files, so everything after parsing sees the same sequence as a sequential read,
+// and at most n files are parsed ahead of the consumer. Closing done stops the workers.
+func parseFiles(src source, files []string, cfg config, n int, done <-chan struct{}) <-chan parsedFile {
+	type job struct {
+		file   string
+		result chan parsedFile
+	}
+
+	jobs := make(chan job)
+	pending := make(chan chan parsedFile, n)
+	out := make(chan parsedFile)
+
+	go func() {
+		defer close(jobs)
+		defer close(pending)
+		for _, f := range files {
+			result := make(chan parsedFile, 1)
+			select {
+			case pending <- result:
+			case <-done:
+				return
+			}
+
+			select {
+			case jobs <- job{f, result}:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < n; i++ {
+		go func() {
+			for j := range jobs {
+				start := time.Now()
+				c, bad, err := createCandles(src, j.file, cfg)
+				j.result <- parsedFile{file: j.file, candles: c, bad: bad, took: time.Since(start), err: err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(out)
+		for result := range pending {
+			var p parsedFile
+			select {
+			case p = <-result:
+			case <-done:
+				return
+			}
+
+			select {
+			case out <- p:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// sink receives the candles of each processed file from streamCandles
+type sink interface {
+	send(c []Candle) error
+	close() error
+}
+
+// seedError is an insert that failed while candles were sent to a sink
+type seedError struct {
+	err error
+}
+
+func (e seedError) Error() string {
+	return fmt.Sprintf("could not seed data. %s", e.err)
+}
+
+func (e seedError) Unwrap() error {
+	return e.err
+}
+
+// seeder seeds the candles of each file as they are sent, before the next file is processed
+type seeder struct {
+	ctx context.Context
+	db  *sqlx.DB
+	cfg config
+	rep *report
+}
+
+func (s seeder) send(c []Candle) error {
+	if err := seed(s.ctx, s.db, c, s.cfg, s.rep); err != nil {
+		return seedError{err}
+	}
+
+	return nil
+}
+
+func (s seeder) close() error {
+	return nil
+}
+
+// inserter seeds batches of candles with -insert-workers workers while files are still being
+// parsed. The first failed insert stops the workers and is returned by close.
+type inserter struct {
+	batches chan []Candle
+	wg      sync.WaitGroup
+
+	closeOnce sync.Once
+	failOnce  sync.Once
+	failed    chan struct{}
+	err       error
+}
+
+func startInserters(ctx context.Context, db *sqlx.DB, cfg config, rep *report) *inserter {
+	in := &inserter{batches: make(chan []Candle), failed: make(chan struct{})}
+	for i := 0; i < cfg.insertWorkers; i++ {
+		in.wg.Add(1)
+		go func() {
+			defer in.wg.Done()
+			for c := range in.batches {
+				if err := seed(ctx, db, c, cfg, rep); err != nil {
+					in.fail(err)
+					return
+				}
+			}
+		}()
+	}
+
+	return in
+}
+
+func (in *inserter) fail(err error) {
+	in.failOnce.Do(func() {
+		in.err = err
+		close(in.failed)
+	})
+}
+
+// send hands the candles of a file to the workers, or returns the error that stopped them
+func (in *inserter) send(c []Candle) error {
+	select {
+	case in.batches <- c:
+		return nil
+	case <-in.failed:
+		return seedError{in.err}
+	}
+}
+
+// close waits for the queued batches to be inserted. It is safe to call more than once.
+func (in *inserter) close() error {
+	in.closeOnce.Do(func() { close(in.batches) })
+	in.wg.Wait()
+
+	select {
+	case <-in.failed:
+		return seedError{in.err}
+	default:
+		return nil
+	}
+}
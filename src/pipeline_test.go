@@ -0,0 +1,127 @@
+package birdseed
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSeedWithMoreParseWorkersThanInsertWorkers(t *testing.T) {
+	db := openTestDB(t)
+
+	// Files of different lengths, so they finish parsing out of order
+	files := map[string]string{}
+	want := map[string]int{}
+	for i, ticker := range []string{"ABT", "AMGN", "BMY", "GILD", "JNJ", "LLY", "MRK", "PFE", "TMO"} {
+		var b strings.Builder
+		b.WriteString("Date,Open,High,Low,Close,Adj Close,Volume\n")
+		rows := 40 * (9 - i)
+		for d := 0; d < rows; d++ {
+			price := float64(50 + i*10 + d%7)
+			fmt.Fprintf(&b, "%s,%g,%g,%g,%g,%g,%d\n", day("2020-01-01").AddDate(0, 0, d).Format(layoutISO), price, price+2, price-1, price+1, price+1, 1000+d)
+		}
+		files[ticker+".csv"] = b.String()
+		want[ticker] = rows
+	}
+	dir := writeDataDir(t, files)
+
+	cfg := testConfig(t, "-data", dir, "-missing-table", "create", "-parse-workers", "4", "-insert-workers", "2")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	rep := newReport()
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, rep); err != nil {
+		t.Fatal(err)
+	}
+
+	for ticker, n := range want {
+		if got := countCandles(t, db, ticker); got != n {
+			t.Errorf("%s has %d candles, want %d", ticker, got, n)
+		}
+	}
+	var total int
+	if err := db.Get(&total, "SELECT COUNT(*) FROM candles"); err != nil {
+		t.Fatal(err)
+	}
+	if total != 1800 || rep.total() != 1800 {
+		t.Errorf("stored %d and reported %d candles, want 1800", total, rep.total())
+	}
+
+	// Every candle of a file is inserted by the same worker, in the order of the file
+	var unordered int
+	if err := db.Get(&unordered, `SELECT COUNT(*) FROM candles a JOIN candles b
+		ON a.ticker = b.ticker AND a.id < b.id AND a.date > b.date`); err != nil {
+		t.Fatal(err)
+	}
+	if unordered != 0 {
+		t.Errorf("%d pairs of candles were stored out of date order", unordered)
+	}
+}
+
+func TestStreamingSeedOfALargeGeneratedFile(t *testing.T) {
+	const rows = 7500
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "IBM.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, "Date,Open,High,Low,Close,Adj Close,Volume")
+	first := day("1995-01-02")
+	for i := 0; i < rows; i++ {
+		// Prices rise in steps and wrap around, so every row is a valid candle with its own values
+		open := 60 + float64(i%997)/10
+		fmt.Fprintf(w, "%s,%.2f,%.2f,%.2f,%.2f,%.2f,%d\n", first.AddDate(0, 0, i).Format(layoutISO), open, open+1.5, open-1.25, open+0.5, open+0.25, 4000000+i)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db := openTestDB(t)
+	cfg := testConfig(t, "-data", dir, "-missing-table", "create")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, newReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored struct {
+		Count int    `db:"count"`
+		First string `db:"first"`
+		Last  string `db:"last"`
+	}
+	if err := db.Get(&stored, "SELECT COUNT(*) AS count, MIN(date) AS first, MAX(date) AS last FROM candles WHERE ticker = 'IBM'"); err != nil {
+		t.Fatal(err)
+	}
+	last := first.AddDate(0, 0, rows-1).Format(layoutISO)
+	if stored.Count != rows || stored.First != "1995-01-02" || stored.Last != last {
+		t.Errorf("stored %d candles from %s to %s, want %d from 1995-01-02 to %s", stored.Count, stored.First, stored.Last, rows, last)
+	}
+
+	// Rows are inserted in the order of the file, so the ids follow the dates
+	dates := []string{}
+	if err := db.Select(&dates, "SELECT date FROM candles ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+	for i, d := range dates {
+		if want := first.AddDate(0, 0, i).Format(layoutISO); d != want {
+			t.Fatalf("candle %d is dated %s, want %s", i, d, want)
+		}
+	}
+
+	var volume int64
+	if err := db.Get(&volume, "SELECT volume FROM candles WHERE date = ?", last); err != nil {
+		t.Fatal(err)
+	}
+	if volume != 4000000+rows-1 {
+		t.Errorf("the last candle has a volume of %d, want %d", volume, 4000000+rows-1)
+	}
+}
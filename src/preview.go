@@ -0,0 +1,77 @@
+package birdseed
+
+import (
+	"fmt"
+	"io"
+)
+
+// preview prints the resolved ticker, row count and the first and last candle by date of
+// every file in the source without touching the database.
+func preview(w io.Writer, src source, cfg config) error {
+	files, err := src.files()
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if !cfg.universe {
+			if _, err := tickerFromFilename(f); err != nil {
+				fmt.Fprintf(w, "%s: no ticker, skipped\n", f)
+				continue
+			}
+		}
+
+		candles, bad, err := createCandles(src, f, cfg)
+		if err != nil {
+			return fmt.Errorf("could not parse '%s'. %w", f, err)
+		}
+
+		// Universe dumps hold many tickers per file, so summarize each ticker separately
+		// in the order they first appear.
+		tickers := []string{}
+		byTicker := map[string][]Candle{}
+		for _, c := range candles {
+			if _, ok := byTicker[c.Ticker]; !ok {
+				tickers = append(tickers, c.Ticker)
+			}
+			byTicker[c.Ticker] = append(byTicker[c.Ticker], c)
+		}
+
+		if len(bad) > 0 {
+			fmt.Fprintf(w, "%s: %d rows could not be parsed\n", f, len(bad))
+		}
+
+		if len(tickers) == 0 {
+			fmt.Fprintf(w, "%s: no rows\n", f)
+			continue
+		}
+
+		for _, ticker := range tickers {
+			first, last := firstAndLast(byTicker[ticker])
+			fmt.Fprintf(w, "%s: ticker=%s rows=%d\n", f, ticker, len(byTicker[ticker]))
+			fmt.Fprintf(w, "  first %s\n", formatCandle(first))
+			fmt.Fprintf(w, "  last  %s\n", formatCandle(last))
+		}
+	}
+
+	return nil
+}
+
+// firstAndLast returns the earliest and latest candle by date, regardless of the file order
+func firstAndLast(candles []Candle) (Candle, Candle) {
+	first, last := candles[0], candles[0]
+	for _, c := range candles[1:] {
+		if c.Date.Before(first.Date) {
+			first = c
+		}
+		if c.Date.After(last.Date) {
+			last = c
+		}
+	}
+
+	return first, last
+}
+
+func formatCandle(c Candle) string {
+	return fmt.Sprintf("%s O=%g H=%g L=%g C=%g V=%d", c.storedDate(), c.Open, c.High, c.Low, c.Close, c.Volume)
+}
@@ -0,0 +1,29 @@
+package birdseed
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPreviewReportsTheFirstAndLastCandleByDate(t *testing.T) {
+	// Newest first, as in Nasdaq downloads
+	dir := writeDataDir(t, map[string]string{
+		"TSLA.csv": "Date,Close/Last,Volume,Open,High,Low\n" +
+			"03/08/2024,$175.34,85315000,$181.50,$182.73,$174.70\n" +
+			"03/07/2024,$178.65,102129000,$176.17,$181.45,$175.72\n" +
+			"03/06/2024,$176.54,107920900,$179.99,$181.58,$173.70\n",
+		"notes.txt": "not a ticker file\n",
+	})
+
+	var out bytes.Buffer
+	if err := preview(&out, dirSource{dir: dir}, testConfig(t, "preview", "-data", dir)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "TSLA.csv: ticker=TSLA rows=3\n" +
+		"  first 2024-03-06 O=179.99 H=181.58 L=173.7 C=176.54 V=107920900\n" +
+		"  last  2024-03-08 O=181.5 H=182.73 L=174.7 C=175.34 V=85315000\n"
+	if !bytes.Contains(out.Bytes(), []byte(want)) {
+		t.Errorf("preview printed\n%s\nwant it to contain\n%s", out.String(), want)
+	}
+}
@@ -0,0 +1,166 @@
+package birdseed
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// selectCandles returns the query selecting stored candles. The adjusted close and interval are
+// only stored with -with-adj-close and -interval, so they are read as NULL and ” from tables
+// without the columns.
+func selectCandles(db *sqlx.DB) (string, error) {
+	columns, err := tableColumns(db)
+	if err != nil {
+		return "", err
+	}
+
+	adjClose := "NULL AS adj_close"
+	if slices.Contains(columns, "adj_close") {
+		adjClose = "adj_close"
+	}
+	interval := "'' AS interval"
+	if slices.Contains(columns, "interval") {
+		interval = "interval"
+	}
+
+	return "SELECT id, ticker, date, open, high, low, close, volume, " + adjClose + ", " + interval + " FROM candles", nil
+}
+
+// candleRow is a candle as stored in the candles table, where the date is kept as text
+type candleRow struct {
+	ID       int64           `db:"id"`
+	Ticker   string          `db:"ticker"`
+	Date     string          `db:"date"`
+	Open     float64         `db:"open"`
+	High     float64         `db:"high"`
+	Low      float64         `db:"low"`
+	Close    float64         `db:"close"`
+	Volume   int64           `db:"volume"`
+	AdjClose sql.NullFloat64 `db:"adj_close"`
+	Interval string          `db:"interval"`
+}
+
+func (r candleRow) candle() (Candle, error) {
+	c := Candle{
+		ID:     r.ID,
+		Ticker: r.Ticker,
+		Open:   r.Open,
+		Close:  r.Close,
+		High:   r.High,
+		Low:    r.Low,
+		Volume: r.Volume,
+
+		Interval: r.Interval,
+
+		// Candles stored without an adjusted close fall back to the raw close, as when parsing
+		AdjClose: r.Close,
+	}
+	if r.AdjClose.Valid {
+		c.AdjClose = r.AdjClose.Float64
+	}
+
+	date, err := time.Parse(layoutISO, r.Date)
+	if err != nil {
+		date, err = time.Parse(layoutTimestamp, r.Date)
+		if err != nil {
+			return Candle{}, fmt.Errorf("could not parse stored date '%s' of ticker '%s'", r.Date, r.Ticker)
+		}
+		c.Intraday = true
+	}
+	c.Date = date
+
+	return c, nil
+}
+
+func toCandles(rows []candleRow) ([]Candle, error) {
+	candles := make([]Candle, 0, len(rows))
+	for _, r := range rows {
+		c, err := r.candle()
+		if err != nil {
+			return nil, err
+		}
+		candles = append(candles, c)
+	}
+
+	return candles, nil
+}
+
+// fetchCandles returns the stored candles of a ticker from the first day up to and including
+// the last day, ordered by date.
+func fetchCandles(db *sqlx.DB, ticker string, from time.Time, to time.Time) ([]Candle, error) {
+	query, err := selectCandles(db)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []candleRow{}
+	err = db.Select(&rows, db.Rebind(query+" WHERE ticker = ? AND date >= ? AND date < ? ORDER BY date"),
+		ticker, from.Format(layoutISO), to.AddDate(0, 0, 1).Format(layoutISO))
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch candles for ticker '%s'. %w", ticker, err)
+	}
+
+	return toCandles(rows)
+}
+
+// storedTickers returns every ticker with stored candles, in sorted order
+func storedTickers(db *sqlx.DB) ([]string, error) {
+	tickers := []string{}
+	if err := db.Select(&tickers, "SELECT DISTINCT ticker FROM candles ORDER BY ticker"); err != nil {
+		return nil, fmt.Errorf("could not fetch tickers. %w", err)
+	}
+
+	return tickers, nil
+}
+
+// tickerCandles returns every stored candle of a ticker, ordered by date. With an interval only
+// the candles of that interval are returned, unless the table stores no intervals at all.
+func tickerCandles(db *sqlx.DB, ticker string, interval string) ([]Candle, error) {
+	query, err := selectCandles(db)
+	if err != nil {
+		return nil, err
+	}
+
+	scope, args := "", []any{}
+	if interval != "" {
+		columns, err := tableColumns(db)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(columns, "interval") {
+			scope, args = intervalClause(interval)
+		}
+	}
+
+	rows := []candleRow{}
+	if err := db.Select(&rows, db.Rebind(query+" WHERE ticker = ?"+scope+" ORDER BY date"), append([]any{ticker}, args...)...); err != nil {
+		return nil, fmt.Errorf("could not fetch candles for ticker '%s'. %w", ticker, err)
+	}
+
+	return toCandles(rows)
+}
+
+// latestCandle returns the most recent stored candle of a ticker, reporting false if it has none
+func latestCandle(db *sqlx.DB, ticker string, interval string) (Candle, bool, error) {
+	query, err := selectCandles(db)
+	if err != nil {
+		return Candle{}, false, err
+	}
+
+	scope, args := intervalClause(interval)
+	rows := []candleRow{}
+	err = db.Select(&rows, db.Rebind(query+" WHERE ticker = ?"+scope+" ORDER BY date DESC LIMIT 1"), append([]any{ticker}, args...)...)
+	if err != nil {
+		return Candle{}, false, fmt.Errorf("could not fetch the latest candle for ticker '%s'. %w", ticker, err)
+	}
+	if len(rows) == 0 {
+		return Candle{}, false, nil
+	}
+
+	c, err := rows[0].candle()
+	return c, err == nil, err
+}
@@ -0,0 +1,188 @@
+package birdseed
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// slowestFilesShown is the number of files listed in the slowest files section of the report
+const slowestFilesShown = 10
+
+// fileTiming records how long parsing and inserting a single file took
+type fileTiming struct {
+	file   string
+	parse  time.Duration
+	insert time.Duration
+}
+
+func (t fileTiming) total() time.Duration {
+	return t.parse + t.insert
+}
+
+// report collects statistics about a run which are printed once it has finished
+type report struct {
+	// start is when the run began, for its duration
+	start time.Time
+	// files is the number of files that were parsed
+	files int
+	// mu guards timings, which -insert-workers record into while files are still being parsed
+	mu      sync.Mutex
+	timings map[string]*fileTiming
+	// skipped holds the tickers that were skipped because their data already exists
+	skipped map[string]bool
+	// failed holds the files skipped by -continue-on-error because they failed to parse
+	failed []string
+	// badRows holds the rows that could not be parsed, for the dead letter table
+	badRows []badRow
+	// counts holds the number of aggregated candles per ticker
+	counts map[string]int
+	// rounded holds the prices changed by -round-prices beyond -rounding-tolerance
+	rounded []roundingChange
+}
+
+func newReport() *report {
+	return &report{start: time.Now(), timings: map[string]*fileTiming{}, skipped: map[string]bool{}, counts: map[string]int{}}
+}
+
+func (r *report) recordCandles(candles []Candle) {
+	for _, c := range candles {
+		r.counts[c.Ticker]++
+	}
+}
+
+// total returns the number of aggregated candles across all tickers
+func (r *report) total() int {
+	total := 0
+	for _, n := range r.counts {
+		total += n
+	}
+
+	return total
+}
+
+func (r *report) recordSkipped(ticker string) {
+	r.skipped[ticker] = true
+}
+
+func (r *report) timing(file string) *fileTiming {
+	t, ok := r.timings[file]
+	if !ok {
+		t = &fileTiming{file: file}
+		r.timings[file] = t
+	}
+
+	return t
+}
+
+func (r *report) recordFailed(file string) {
+	r.failed = append(r.failed, file)
+}
+
+func (r *report) recordBadRows(rows []badRow) {
+	r.badRows = append(r.badRows, rows...)
+}
+
+func (r *report) recordRounding(changes []roundingChange) {
+	r.rounded = append(r.rounded, changes...)
+}
+
+func (r *report) recordParse(file string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files++
+	r.timing(file).parse += d
+}
+
+func (r *report) recordInsert(file string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timing(file).insert += d
+}
+
+// slowestFiles returns the timings of the n files that took the longest to parse and insert
+func (r *report) slowestFiles(n int) []fileTiming {
+	timings := make([]fileTiming, 0, len(r.timings))
+	for _, t := range r.timings {
+		timings = append(timings, *t)
+	}
+
+	sort.Slice(timings, func(i, j int) bool {
+		if timings[i].total() != timings[j].total() {
+			return timings[i].total() > timings[j].total()
+		}
+		return timings[i].file < timings[j].file
+	})
+
+	if len(timings) > n {
+		timings = timings[:n]
+	}
+
+	return timings
+}
+
+// reportSummary is the JSON form of a report, as posted to -webhook-url and printed by -json-summary
+type reportSummary struct {
+	Success  bool           `json:"success"`
+	Error    string         `json:"error,omitempty"`
+	Files    int            `json:"files"`
+	Candles  int            `json:"candles"`
+	Tickers  map[string]int `json:"tickers"`
+	Skipped  []string       `json:"skipped"`
+	Failed   []string       `json:"failed_files"`
+	BadRows  int            `json:"bad_rows"`
+	Duration float64        `json:"duration_seconds"`
+}
+
+// summary returns the JSON summary of the run, which failed if err is not nil
+func (r *report) summary(err error) reportSummary {
+	s := reportSummary{
+		Success:  err == nil,
+		Files:    r.files,
+		Tickers:  r.counts,
+		Skipped:  []string{},
+		Failed:   append([]string{}, r.failed...),
+		BadRows:  len(r.badRows),
+		Duration: time.Since(r.start).Seconds(),
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+
+	s.Candles = r.total()
+
+	for ticker := range r.skipped {
+		s.Skipped = append(s.Skipped, ticker)
+	}
+	sort.Strings(s.Skipped)
+
+	return s
+}
+
+func (r *report) print(w io.Writer, cfg config) {
+	fmt.Fprintf(w, "Processed %d files in %s: seeded %d candles of %d tickers, skipped %d tickers that already exist and %d malformed rows.\n",
+		r.files, time.Since(r.start).Round(time.Millisecond), r.total(), len(r.counts), len(r.skipped), len(r.badRows))
+
+	if cfg.continueOnError && len(r.failed) > 0 {
+		fmt.Fprintf(w, "Skipped %d files that failed to parse:\n", len(r.failed))
+		for _, f := range r.failed {
+			fmt.Fprintf(w, "  %s\n", f)
+		}
+	}
+
+	if cfg.roundingReport {
+		fmt.Fprintf(w, "Rounding changed %d prices by more than %g:\n", len(r.rounded), cfg.roundingTolerance)
+		for _, c := range r.rounded {
+			fmt.Fprintf(w, "  %s %s %s: parsed=%g stored=%g\n", c.ticker, c.date, c.field, c.parsed, c.stored)
+		}
+	}
+
+	if cfg.fileTimings {
+		fmt.Fprintln(w, "Slowest files:")
+		for _, t := range r.slowestFiles(slowestFilesShown) {
+			fmt.Fprintf(w, "  %s: total=%s parse=%s insert=%s\n", t.file, t.total(), t.parse, t.insert)
+		}
+	}
+}
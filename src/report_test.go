@@ -0,0 +1,60 @@
+package birdseed
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileTimingsAreRecordedPerFile(t *testing.T) {
+	db := openTestDB(t)
+	dir := writeDataDir(t, map[string]string{
+		"KO.csv":  "Date,Open,High,Low,Close,Volume\n2018-01-02,46,46.3,45.6,45.9,11000000\n",
+		"PEP.csv": "Date,Open,High,Low,Close,Volume\n2018-01-02,120,120.3,118.4,118.9,4900000\n2018-01-03,119,119.9,118.6,119.7,4200000\n",
+	})
+	cfg := testConfig(t, "-data", dir, "-missing-table", "create", "-report-file-timings")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	rep := newReport()
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, rep); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []string{"KO.csv", "PEP.csv"} {
+		timing, ok := rep.timings[f]
+		if !ok {
+			t.Errorf("no timing was recorded for %s", f)
+			continue
+		}
+		if timing.parse <= 0 || timing.insert <= 0 {
+			t.Errorf("%s took parse=%s insert=%s, want both recorded", f, timing.parse, timing.insert)
+		}
+	}
+
+	var out bytes.Buffer
+	rep.print(&out, cfg)
+	_, section, found := strings.Cut(out.String(), "Slowest files:\n")
+	if !found || !strings.Contains(section, "  KO.csv: total=") || !strings.Contains(section, "  PEP.csv: total=") {
+		t.Errorf("the slowest files section does not list both files:\n%s", out.String())
+	}
+}
+
+func TestSlowestFilesAreSortedByTotalDuration(t *testing.T) {
+	rep := newReport()
+	rep.recordParse("small.csv", time.Millisecond)
+	rep.recordParse("huge.csv", 40*time.Millisecond)
+	rep.recordInsert("small.csv", 2*time.Millisecond)
+	rep.recordParse("medium.csv", 5*time.Millisecond)
+	rep.recordInsert("medium.csv", 30*time.Millisecond)
+
+	got := []string{}
+	for _, timing := range rep.slowestFiles(2) {
+		got = append(got, timing.file)
+	}
+	if strings.Join(got, ",") != "huge.csv,medium.csv" {
+		t.Errorf("the two slowest files are %v, want huge.csv and medium.csv", got)
+	}
+}
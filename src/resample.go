@@ -0,0 +1,96 @@
+package birdseed
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// resampleSource is the interval of the stored candles that -resample aggregates
+const resampleSource = "daily"
+
+// resample aggregates the stored daily candles of every ticker into weekly or monthly candles and
+// stores them with that interval. Existing candles of the interval are updated, so the partial
+// period at the end of a series is completed by running it again once more days are stored.
+func resample(ctx context.Context, db *sqlx.DB, cfg config) error {
+	tickers, err := storedTickers(db)
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	for _, ticker := range tickers {
+		daily, err := intervalCandles(db, ticker, resampleSource)
+		if err != nil {
+			return err
+		}
+		if len(daily) == 0 {
+			continue
+		}
+
+		candles := resampleCandles(daily, cfg.resample)
+		slog.Debug("Resampling candles.", "ticker", ticker, "daily", len(daily), cfg.resample, len(candles))
+		if err := bulkInsert(ctx, db, candles, cfg); err != nil {
+			return fmt.Errorf("could not store %s candles for ticker '%s'. %w", cfg.resample, ticker, err)
+		}
+		total += len(candles)
+	}
+	slog.Info("Successfully stored resampled candles.", "interval", cfg.resample, "candles", total)
+
+	return nil
+}
+
+// resampleCandles groups date ordered daily candles of a single ticker by ISO week or calendar
+// month, merging each group into a candle dated on the first day of its period. Periods without
+// any candle, e.g. a week of holidays, produce no candle, and periods cut short at either end of
+// the series are merged from the days there are.
+func resampleCandles(candles []Candle, interval string) []Candle {
+	resampled := []Candle{}
+	for start := 0; start < len(candles); {
+		period := periodStart(candles[start].Date, interval)
+		end := start + 1
+		for end < len(candles) && periodStart(candles[end].Date, interval).Equal(period) {
+			end++
+		}
+
+		c := mergeCandles(candles[start:end])
+		c.Date = period
+		c.Interval = interval
+		c.Source = ""
+		c.Return = nil
+		resampled = append(resampled, c)
+
+		start = end
+	}
+
+	return resampled
+}
+
+// periodStart returns the monday of the ISO week, or the first day of the month, of a date
+func periodStart(date time.Time, interval string) time.Time {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	if interval == "monthly" {
+		return day.AddDate(0, 0, 1-day.Day())
+	}
+
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// intervalCandles returns the stored candles of a ticker with the given interval, ordered by date
+func intervalCandles(db *sqlx.DB, ticker string, interval string) ([]Candle, error) {
+	query, err := selectCandles(db)
+	if err != nil {
+		return nil, err
+	}
+
+	scope, args := intervalClause(interval)
+	rows := []candleRow{}
+	if err := db.Select(&rows, db.Rebind(query+" WHERE ticker = ?"+scope+" ORDER BY date"), append([]any{ticker}, args...)...); err != nil {
+		return nil, fmt.Errorf("could not fetch %s candles for ticker '%s'. %w", interval, ticker, err)
+	}
+
+	return toCandles(rows)
+}
@@ -0,0 +1,98 @@
+package birdseed
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestResampleCandlesMergesEachWeek(t *testing.T) {
+	candle := func(d string, open, high, low, close float64, volume int64) Candle {
+		return Candle{Ticker: "V", Date: day(d), Open: open, High: high, Low: low, Close: close, Volume: volume, Interval: "daily", Source: "V.csv"}
+	}
+	daily := []Candle{
+		// The series starts on a wednesday
+		candle("2024-03-27", 279.1, 280.4, 277.9, 280, 5100),
+		candle("2024-03-28", 280.2, 281.7, 279.3, 279.1, 4800),
+		// A full week
+		candle("2024-04-01", 278.8, 279.5, 275.2, 276.4, 6200),
+		candle("2024-04-02", 275.9, 277.3, 272.8, 273.5, 7100),
+		candle("2024-04-03", 273.1, 276, 271.6, 275.7, 5900),
+		candle("2024-04-04", 276.2, 282.9, 275.8, 281.6, 8800),
+		candle("2024-04-05", 281, 281.9, 274.4, 275.2, 6600),
+		// The week of 2024-04-08 has no trading days, and the series ends on a tuesday
+		candle("2024-04-15", 276.5, 278.1, 271.2, 271.9, 7300),
+		candle("2024-04-16", 272, 273.4, 269.5, 270.8, 6900),
+	}
+
+	weekly := resampleCandles(daily, "weekly")
+	want := []Candle{
+		{Ticker: "V", Date: day("2024-03-25"), Open: 279.1, High: 281.7, Low: 277.9, Close: 279.1, Volume: 9900},
+		{Ticker: "V", Date: day("2024-04-01"), Open: 278.8, High: 282.9, Low: 271.6, Close: 275.2, Volume: 34600},
+		{Ticker: "V", Date: day("2024-04-15"), Open: 276.5, High: 278.1, Low: 269.5, Close: 270.8, Volume: 14200},
+	}
+	if len(weekly) != len(want) {
+		t.Fatalf("resampled %d weeks, want %d: %+v", len(weekly), len(want), weekly)
+	}
+	for i, w := range want {
+		got := weekly[i]
+		if !got.Equal(w, 1e-9) || got.Interval != "weekly" || got.Source != "" {
+			t.Errorf("week %d is %s (%s, %q), want %s", i, formatCandle(got), got.Interval, got.Source, formatCandle(w))
+		}
+	}
+
+	monthly := resampleCandles(daily, "monthly")
+	if len(monthly) != 2 || monthly[0].storedDate() != "2024-03-01" || monthly[1].storedDate() != "2024-04-01" {
+		t.Fatalf("resampled the months to %+v", monthly)
+	}
+	if m := monthly[1]; m.Open != 278.8 || m.Close != 270.8 || m.High != 282.9 || m.Low != 269.5 || m.Volume != 48800 {
+		t.Errorf("april is %s", formatCandle(m))
+	}
+}
+
+func TestResampleAgainCompletesThePartialLastWeek(t *testing.T) {
+	db := openTestDB(t)
+	daily := testConfig(t, "-missing-table", "create", "-interval", "daily")
+	if err := prepareSchema(db, daily); err != nil {
+		t.Fatal(err)
+	}
+	store := func(days ...Candle) {
+		t.Helper()
+		if err := bulkInsert(context.Background(), db, days, daily); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store(
+		Candle{Ticker: "MA", Date: day("2024-05-06"), Open: 452, High: 455, Low: 450, Close: 454, Volume: 2000, Interval: "daily"},
+		Candle{Ticker: "MA", Date: day("2024-05-07"), Open: 454, High: 458, Low: 453, Close: 457, Volume: 2100, Interval: "daily"},
+	)
+
+	weeklyCfg := testConfig(t, "-resample", "weekly")
+	if err := prepareSchema(db, weeklyCfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := resample(context.Background(), db, weeklyCfg); err != nil {
+		t.Fatal(err)
+	}
+
+	// The rest of the week is seeded later, and the week is resampled again
+	store(
+		Candle{Ticker: "MA", Date: day("2024-05-08"), Open: 457, High: 463, Low: 456, Close: 461, Volume: 2500, Interval: "daily"},
+		Candle{Ticker: "MA", Date: day("2024-05-10"), Open: 460, High: 461, Low: 447, Close: 449, Volume: 3100, Interval: "daily"},
+	)
+	if err := resample(context.Background(), db, weeklyCfg); err != nil {
+		t.Fatal(err)
+	}
+
+	weeks, err := intervalCandles(db, "MA", "weekly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Candle{Ticker: "MA", Date: day("2024-05-06"), Open: 452, High: 463, Low: 447, Close: 449, Volume: 9700}
+	if len(weeks) != 1 || !weeks[0].Equal(want, 1e-9) {
+		t.Errorf("stored the weeks %+v, want only %s", weeks, formatCandle(want))
+	}
+	if weeks[0].Date.Weekday() != time.Monday {
+		t.Errorf("the week is dated on a %s", weeks[0].Date.Weekday())
+	}
+}
@@ -0,0 +1,81 @@
+package birdseed
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// transientMessages are parts of error messages of drivers that report connection problems as
+// plain text, e.g. libsql over HTTP, or a database that is busy for a moment
+var transientMessages = []string{
+	"connection reset",
+	"connection refused",
+	"broken pipe",
+	"unexpected eof",
+	"i/o timeout",
+	"tls handshake timeout",
+	"temporarily unavailable",
+	"database is locked",
+	"sqlite_busy",
+	"502 bad gateway",
+	"503 service unavailable",
+	"504 gateway timeout",
+	"too many requests",
+}
+
+// isTransient reports whether an insert failed for a reason that may go away by trying again,
+// such as a dropped connection. Constraint violations, bad values and cancellation are not.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, m := range transientMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withRetries calls insert until it succeeds, fails for a reason that is not transient or has
+// been retried -max-retries times, waiting -retry-delay before the first retry and twice as long
+// before every next one. The attributes describe the candles in the retry warnings.
+func withRetries(ctx context.Context, cfg config, insert func() error, attrs ...any) error {
+	delay := cfg.retryDelay
+	for attempt := 1; ; attempt++ {
+		err := insert()
+		if err == nil || attempt > cfg.maxRetries || !isTransient(err) {
+			return err
+		}
+
+		slog.Warn("Could not insert candles. Retrying.",
+			append(append([]any{}, attrs...), "in", delay, "attempt", attempt, "of", cfg.maxRetries, "err", err)...)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,151 @@
+package birdseed
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"modernc.org/sqlite"
+)
+
+// lockingDriver is a SQLite driver whose inserts fail as locked on the given attempts, counted
+// over every executed insert statement, and which records the first date of every insert
+type lockingDriver struct {
+	mu     sync.Mutex
+	failOn map[int]bool
+	dates  []string
+}
+
+func (d *lockingDriver) Open(name string) (driver.Conn, error) {
+	c, err := (&sqlite.Driver{}).Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return lockingConn{c, d}, nil
+}
+
+func (d *lockingDriver) reset(failOn ...int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.failOn = map[int]bool{}
+	for _, n := range failOn {
+		d.failOn[n] = true
+	}
+	d.dates = nil
+}
+
+type lockingConn struct {
+	driver.Conn
+	d *lockingDriver
+}
+
+func (c lockingConn) Prepare(query string) (driver.Stmt, error) {
+	s, err := c.Conn.Prepare(query)
+	if err != nil || !strings.HasPrefix(query, "INSERT") {
+		return s, err
+	}
+
+	return lockingStmt{s, c.d}, nil
+}
+
+type lockingStmt struct {
+	driver.Stmt
+	d *lockingDriver
+}
+
+func (s lockingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	s.d.dates = append(s.d.dates, args[0].(string))
+	fail := s.d.failOn[len(s.d.dates)]
+	s.d.mu.Unlock()
+	if fail {
+		return nil, errors.New("database is locked (5) (SQLITE_BUSY)")
+	}
+
+	return s.Stmt.Exec(args)
+}
+
+var locking = &lockingDriver{}
+
+func init() {
+	sql.Register("locking", locking)
+	sqlx.BindDriver("locking", sqlx.QUESTION)
+}
+
+func TestLockedTransactionsAreRetriedFromTheirFirstCandle(t *testing.T) {
+	db, err := sqlx.Open("locking", filepath.Join(t.TempDir(), "candles.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	cfg := testConfig(t, "-missing-table", "create", "-batch", "2", "-tx-size", "3", "-retry-delay", "10ms", "-max-retries", "3")
+	if err := ensureSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	candles := []Candle{}
+	for _, d := range []string{"2024-02-05", "2024-02-06", "2024-02-07", "2024-02-08", "2024-02-09", "2024-02-12"} {
+		candles = append(candles, Candle{Ticker: "WMT", Date: day(d), Open: 168, High: 170, Low: 167, Close: 169, Volume: 6000000})
+	}
+
+	// The second statement of the transaction fails on the first two attempts
+	locking.reset(2, 4)
+	logs := captureLogs(t)
+	if err := bulkInsert(context.Background(), db, candles, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each attempt starts again from the first candle of the transaction
+	if got := strings.Join(locking.dates, ","); got != "2024-02-05,2024-02-07,2024-02-05,2024-02-07,2024-02-05,2024-02-07,2024-02-09" {
+		t.Errorf("the statements started at %s", got)
+	}
+	for _, want := range []string{"in=10ms attempt=1 of=3", "in=20ms attempt=2 of=3"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("the retries did not log %q, got\n%s", want, logs.String())
+		}
+	}
+
+	var rows, dates int
+	if err := db.Get(&rows, "SELECT COUNT(*) FROM candles"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Get(&dates, "SELECT COUNT(DISTINCT date) FROM candles"); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 6 || dates != 6 {
+		t.Errorf("stored %d rows of %d dates, want each of the 6 candles once", rows, dates)
+	}
+}
+
+func TestConstraintViolationsAreNotRetried(t *testing.T) {
+	db, err := sqlx.Open("locking", filepath.Join(t.TempDir(), "candles.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	cfg := testConfig(t, "-missing-table", "create", "-retry-delay", "10ms")
+	if err := ensureSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	candle := Candle{Ticker: "KO", Date: day("2024-02-05"), Open: 60, High: 61, Low: 59.5, Close: 60.4, Volume: 9000000}
+	if err := bulkInsert(context.Background(), db, []Candle{candle}, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	locking.reset()
+	logs := captureLogs(t)
+	err = bulkInsert(context.Background(), db, []Candle{candle}, cfg)
+	if err == nil || !strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		t.Fatalf("expected the duplicate candle to violate the unique index, got %v", err)
+	}
+	if len(locking.dates) != 1 || strings.Contains(logs.String(), "Retrying") {
+		t.Errorf("the constraint violation was retried, %d attempts:\n%s", len(locking.dates), logs.String())
+	}
+}
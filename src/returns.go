@@ -0,0 +1,49 @@
+package birdseed
+
+import (
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// computeReturns sets the daily return (close - prevClose) / prevClose of every candle, in date
+// order per ticker. prev holds the last candle of each ticker seen so far and is carried across
+// files, so the first candle of a ticker only has no return when nothing came before it.
+func computeReturns(candles []Candle, prev map[string]Candle) {
+	order := make([]int, len(candles))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return candles[order[i]].Date.Before(candles[order[j]].Date)
+	})
+
+	for _, i := range order {
+		c := &candles[i]
+		if p, ok := prev[c.Ticker]; ok && p.storedDate() < c.storedDate() && p.Close != 0 {
+			r := (c.Close - p.Close) / p.Close
+			c.Return = &r
+		}
+		prev[c.Ticker] = *c
+	}
+}
+
+// loadStoredCloses adds the latest stored candle of every ticker of the candles that is not in
+// prev yet, so candles appended to a ticker get their return from the last stored close
+func loadStoredCloses(db *sqlx.DB, candles []Candle, prev map[string]Candle, cfg config) error {
+	for _, c := range candles {
+		if _, ok := prev[c.Ticker]; ok {
+			continue
+		}
+
+		stored, ok, err := latestCandle(db, c.Ticker, cfg.interval)
+		if err != nil {
+			return err
+		}
+		if ok {
+			prev[c.Ticker] = stored
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package birdseed
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"testing"
+)
+
+func TestWithReturnsStoresTheDailyReturn(t *testing.T) {
+	db := openTestDB(t)
+	// Newest first, so the return must follow the dates rather than the rows
+	dir := writeDataDir(t, map[string]string{
+		"PFE.csv": "Date,Close/Last,Volume,Open,High,Low\n05/03/2023,$38.61,21000000,$37.70,$38.80,$37.60\n05/02/2023,$37.75,24000000,$38.40,$38.60,$37.50\n",
+	})
+	cfg := testConfig(t, "-data", dir, "-missing-table", "create", "-with-returns")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, newReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := []struct {
+		Date   string          `db:"date"`
+		Return sql.NullFloat64 `db:"return"`
+	}{}
+	if err := db.Select(&rows, `SELECT date, "return" FROM candles WHERE ticker = 'PFE' ORDER BY date`); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("stored %d candles, want 2", len(rows))
+	}
+	if rows[0].Return.Valid {
+		t.Errorf("the first candle has a return of %g, want NULL", rows[0].Return.Float64)
+	}
+	want := (38.61 - 37.75) / 37.75
+	if !rows[1].Return.Valid || math.Abs(rows[1].Return.Float64-want) > 1e-12 {
+		t.Errorf("the return of %s is %v, want %g", rows[1].Date, rows[1].Return, want)
+	}
+}
@@ -0,0 +1,68 @@
+package birdseed
+
+import (
+	"sort"
+	"time"
+)
+
+// rollupDaily aggregates intraday candles into one daily candle per ticker and calendar day.
+// Day boundaries are taken in loc, so bars given in exchange-local time end up on the trading
+// day they belong to even though they are stored in UTC. Daily candles are kept as they are.
+func rollupDaily(candles []Candle, loc *time.Location) []Candle {
+	type key struct {
+		ticker string
+		day    time.Time
+	}
+
+	keys := []key{}
+	groups := map[key][]Candle{}
+	daily := []Candle{}
+	for _, c := range candles {
+		if !c.Intraday {
+			daily = append(daily, c)
+			continue
+		}
+
+		local := c.Date.In(loc)
+		k := key{ticker: c.Ticker, day: time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)}
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], c)
+	}
+
+	for _, k := range keys {
+		c := mergeCandles(groups[k])
+		c.Date = k.day
+		c.Intraday = false
+		daily = append(daily, c)
+	}
+
+	return daily
+}
+
+// mergeCandles combines candles of the same ticker into a single candle spanning all of them,
+// with the first open, the last close, the highest high, the lowest low and the summed volume.
+// The merged candle takes the date of the first candle.
+func mergeCandles(candles []Candle) Candle {
+	sorted := append([]Candle(nil), candles...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date.Before(sorted[j].Date)
+	})
+
+	merged := sorted[0]
+	merged.ID = 0
+	for _, c := range sorted[1:] {
+		merged.Close = c.Close
+		merged.AdjClose = c.AdjClose
+		if c.High > merged.High {
+			merged.High = c.High
+		}
+		if c.Low < merged.Low {
+			merged.Low = c.Low
+		}
+		merged.Volume += c.Volume
+	}
+
+	return merged
+}
@@ -0,0 +1,74 @@
+package birdseed
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRollupDailyMergesADayOfMinuteBars(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bar := func(ts string, open, high, low, close float64, volume int64) Candle {
+		date, err := time.ParseInLocation(layoutTimestamp, ts, ny)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Candle{Ticker: "QQQ", Date: date.UTC(), Open: open, High: high, Low: low, Close: close, Volume: volume, Intraday: true}
+	}
+
+	// Out of order, and the after hours bars fall on the next day in UTC
+	candles := rollupDaily([]Candle{
+		bar("2024-06-03 09:31:00", 451.2, 451.9, 450.8, 451.5, 1200),
+		bar("2024-06-03 09:30:00", 450.0, 451.4, 449.6, 451.2, 3400),
+		bar("2024-06-03 19:58:00", 452.1, 452.3, 451.7, 452.0, 300),
+		bar("2024-06-03 20:01:00", 452.0, 455.0, 452.0, 454.8, 100),
+		bar("2024-06-04 09:30:00", 453.0, 453.5, 452.2, 452.9, 2800),
+	}, ny)
+
+	if len(candles) != 2 {
+		t.Fatalf("rolled up %d candles, want one per trading day", len(candles))
+	}
+	want := Candle{Ticker: "QQQ", Date: day("2024-06-03"), Open: 450.0, High: 455.0, Low: 449.6, Close: 454.8, Volume: 5000}
+	if got := candles[0]; !got.Equal(want, 1e-9) || got.Intraday {
+		t.Errorf("rolled up %s, want %s", formatCandle(got), formatCandle(want))
+	}
+	if got := candles[1]; got.storedDate() != "2024-06-04" || got.Volume != 2800 {
+		t.Errorf("the second day rolled up to %s", formatCandle(got))
+	}
+}
+
+func TestRollupDailyReseedSkipsTheStoredDays(t *testing.T) {
+	db := openTestDB(t)
+	dir := writeDataDir(t, map[string]string{
+		"SPY.csv": "Date,Open,High,Low,Close,Volume\n" +
+			"2024-03-01 14:30:00,508.1,508.6,507.9,508.4,91000\n" +
+			"2024-03-01 14:31:00,508.4,508.9,508.2,508.8,64000\n" +
+			"2024-03-04 14:30:00,510.2,510.4,509.6,509.9,88000\n",
+	})
+	cfg := testConfig(t, "-data", dir, "-missing-table", "create", "-rollup", "daily")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	for run := 1; run <= 2; run++ {
+		rep := newReport()
+		if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, rep); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+		if run == 2 && !rep.skipped["SPY"] {
+			t.Errorf("the second run did not skip the rolled up days, skipped %v", rep.skipped)
+		}
+	}
+
+	dates := []string{}
+	if err := db.Select(&dates, "SELECT date FROM candles WHERE ticker = 'SPY' ORDER BY date"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(dates, ",") != "2024-03-01,2024-03-04" {
+		t.Errorf("stored %v, want one candle per day", dates)
+	}
+}
@@ -0,0 +1,36 @@
+package birdseed
+
+import "math"
+
+// roundingChange is a price that changed by more than -rounding-tolerance when rounded by -round-prices
+type roundingChange struct {
+	ticker string
+	date   string
+	field  string
+	parsed float64
+	stored float64
+}
+
+// roundCandles rounds the prices of the candles to the given number of decimals and returns the
+// prices that moved by more than tol in the process
+func roundCandles(candles []Candle, decimals int, tol float64) []roundingChange {
+	changes := []roundingChange{}
+	scale := math.Pow(10, float64(decimals))
+	for i := range candles {
+		c := &candles[i]
+		prices := []struct {
+			field string
+			value *float64
+		}{{"open", &c.Open}, {"high", &c.High}, {"low", &c.Low}, {"close", &c.Close}, {"adj_close", &c.AdjClose}}
+
+		for _, p := range prices {
+			parsed := *p.value
+			*p.value = math.Round(parsed*scale) / scale
+			if math.Abs(*p.value-parsed) > tol {
+				changes = append(changes, roundingChange{c.Ticker, c.storedDate(), p.field, parsed, *p.value})
+			}
+		}
+	}
+
+	return changes
+}
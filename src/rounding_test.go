@@ -0,0 +1,36 @@
+package birdseed
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRoundingReportListsThePricesRoundingChanged(t *testing.T) {
+	// Sub-penny prices as delivered by some vendors, only the open of the first day and the low
+	// of the second move by more than the tolerance
+	dir := writeDataDir(t, map[string]string{
+		"F.csv": "Date,Open,High,Low,Close,Volume\n" +
+			"2023-05-01,12.0472,12.2,11.9,12.0801,41000000\n" +
+			"2023-05-02,12.1,12.25,11.8449,12,39000000\n",
+	})
+	cfg := testConfig(t, "-data", dir, "-round-prices", "2", "-rounding-report", "-rounding-tolerance", "0.0025")
+	rep := newReport()
+	candles, err := aggregateCandlesFromFiles(context.Background(), nil, dirSource{dir: dir}, cfg, rep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if candles[0].Open != 12.05 || candles[1].Low != 11.84 {
+		t.Errorf("rounded to %s and %s", formatCandle(candles[0]), formatCandle(candles[1]))
+	}
+
+	var out bytes.Buffer
+	rep.print(&out, cfg)
+	want := "Rounding changed 2 prices by more than 0.0025:\n" +
+		"  F 2023-05-01 open: parsed=12.0472 stored=12.05\n" +
+		"  F 2023-05-02 low: parsed=11.8449 stored=11.84\n"
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("the report is\n%s\nwant it to contain\n%s", out.String(), want)
+	}
+}
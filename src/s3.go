@@ -0,0 +1,80 @@
+package birdseed
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// s3Source reads the csv objects under a prefix of an S3 bucket, streaming each object rather
+// than downloading it to disk first. Credentials are resolved through the standard AWS chain.
+type s3Source struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+// newS3Source creates a source for a location such as s3://bucket/prefix
+func newS3Source(location string, pathStyle bool) (*s3Source, error) {
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("invalid -s3 location '%s', expected s3://bucket/prefix", location)
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("could not load AWS configuration. %w", err)
+	}
+
+	return &s3Source{
+		client: s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+			o.UsePathStyle = pathStyle
+		}),
+		bucket: u.Host,
+		prefix: strings.TrimPrefix(u.Path, "/"),
+	}, nil
+}
+
+func (s *s3Source) files() ([]string, error) {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix),
+	})
+
+	keys := []string{}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("could not list objects in s3://%s/%s. %w", s.bucket, s.prefix, err)
+		}
+
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			// Skip the placeholder objects some tools create for folders
+			if strings.HasSuffix(key, "/") {
+				continue
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+func (s *s3Source) open(key string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not get s3://%s/%s. %w", s.bucket, key, err)
+	}
+
+	return out.Body, nil
+}
@@ -0,0 +1,87 @@
+package birdseed
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// fakeS3 serves the objects of a single bucket over the path style S3 API, answering
+// ListObjectsV2 on the bucket and GetObject on its keys
+func fakeS3(t *testing.T, bucket string, objects map[string]string) *httptest.Server {
+	t.Helper()
+
+	// S3 lists keys in lexicographic order
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/"+bucket || r.URL.Path == "/"+bucket+"/" {
+			prefix := r.URL.Query().Get("prefix")
+			var contents strings.Builder
+			for _, key := range keys {
+				if strings.HasPrefix(key, prefix) {
+					fmt.Fprintf(&contents, "<Contents><Key>%s</Key><Size>%d</Size></Contents>", key, len(objects[key]))
+				}
+			}
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult><Name>%s</Name><Prefix>%s</Prefix><IsTruncated>false</IsTruncated>%s</ListBucketResult>`,
+				bucket, prefix, contents.String())
+			return
+		}
+
+		body, ok := objects[strings.TrimPrefix(r.URL.Path, "/"+bucket+"/")]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+
+	// Static credentials keep the SDK away from any real AWS configuration
+	t.Setenv("AWS_ENDPOINT_URL_S3", srv.URL)
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+
+	return srv
+}
+
+func TestSeedFromS3SeedsEveryObjectUnderThePrefix(t *testing.T) {
+	fakeS3(t, "archive", map[string]string{
+		"daily/":         "",
+		"daily/AAPL.csv": "Date,Open,High,Low,Close,Volume\n2024-05-01,169.6,172.7,169.1,169.3,50300000\n2024-05-02,172.5,173.4,170.9,173.0,94200000\n",
+		"daily/MSFT.csv": "Date,Open,High,Low,Close,Volume\n2024-05-01,392.6,401.7,390.3,394.9,38000000\n",
+		"other/TSLA.csv": "Date,Open,High,Low,Close,Volume\n2024-05-01,182,185.9,178,179.99,92000000\n",
+	})
+
+	cfg := testConfig(t, "-s3", "s3://archive/daily/", "-s3-path-style", "-missing-table", "create")
+	src, err := newSource(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := openTestDB(t)
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := seedDatabase(context.Background(), db, src, cfg, newReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	for ticker, want := range map[string]int{"AAPL": 2, "MSFT": 1, "TSLA": 0} {
+		if n := countCandles(t, db, ticker); n != want {
+			t.Errorf("%s has %d candles, want %d", ticker, n, want)
+		}
+	}
+}
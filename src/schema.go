@@ -0,0 +1,210 @@
+package birdseed
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// columnDefinitions holds the SQL type of every column that can be written by bulkInsert
+var columnDefinitions = map[string]string{
+	"date":        "TEXT NOT NULL",
+	"ticker":      "TEXT NOT NULL",
+	"open":        "REAL NOT NULL",
+	"high":        "REAL NOT NULL",
+	"low":         "REAL NOT NULL",
+	"close":       "REAL NOT NULL",
+	"volume":      "INTEGER NOT NULL",
+	"source_file": "TEXT",
+	"adj_close":   "REAL",
+	"interval":    "TEXT NOT NULL",
+	"return":      "REAL",
+	"created_at":  "TEXT",
+}
+
+// prepareSchema makes sure the candles table exists before any query runs against it. A missing
+// table is either created or reported, depending on -missing-table. An existing table must have
+// every column the current options write.
+func prepareSchema(db *sqlx.DB, cfg config) error {
+	if cfg.ensureSchema {
+		if err := ensureSchema(db, cfg); err != nil {
+			return err
+		}
+		return checkSchema(db, cfg)
+	}
+
+	exists, err := tableExists(db)
+	if err != nil {
+		return err
+	}
+	if exists {
+		// -upsert and -insert-ignore rely on the unique index to detect stored rows, and with
+		// -interval it covers the interval column, so the table must have it first
+		if err := checkSchema(db, cfg); err != nil {
+			return err
+		}
+		if cfg.upsert || cfg.insertIgnore {
+			return ensureIndex(db, cfg)
+		}
+		return nil
+	}
+
+	if cfg.missingTable == "create" {
+		slog.Info("The candles table does not exist. Creating it.")
+		return ensureSchema(db, cfg)
+	}
+
+	return fmt.Errorf("the candles table does not exist. Create it first, or run with -missing-table create or -ensure-schema")
+}
+
+func tableExists(db *sqlx.DB) (bool, error) {
+	query := "SELECT COUNT(1) FROM sqlite_master WHERE type = 'table' AND name = 'candles'"
+	if isPostgres(db) {
+		query = "SELECT COUNT(1) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'candles'"
+	}
+
+	var count int64
+	if err := db.Get(&count, query); err != nil {
+		return false, fmt.Errorf("could not check whether the candles table exists. %w", err)
+	}
+
+	return count > 0, nil
+}
+
+// checkSchema compares the columns of the candles table with those written by bulkInsert, so a
+// table created before an option was enabled fails upfront rather than on the first insert.
+func checkSchema(db *sqlx.DB, cfg config) error {
+	existing, err := tableColumns(db)
+	if err != nil {
+		return err
+	}
+
+	columns := map[string]bool{}
+	for _, c := range existing {
+		columns[c] = true
+	}
+
+	// -resample reads daily candles by their interval and stores the aggregated ones beside them
+	if cfg.resample != "" && !columns["interval"] {
+		return fmt.Errorf("the candles table has no interval column, so -resample cannot tell daily candles apart. Seed the daily candles with -interval daily first")
+	}
+
+	missing := []string{}
+	for _, c := range insertColumns(cfg) {
+		if !columns[c] {
+			missing = append(missing, c+" "+columnDefinition(db, c))
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("the candles table is missing the columns required by the current options: %s. It has the columns %s",
+			strings.Join(missing, ", "), strings.Join(existing, ", "))
+	}
+
+	return nil
+}
+
+// tableColumns returns the names of the columns of the candles table, in their order
+func tableColumns(db *sqlx.DB) ([]string, error) {
+	query := "SELECT name FROM pragma_table_info('candles')"
+	if isPostgres(db) {
+		query = "SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'candles' ORDER BY ordinal_position"
+	}
+
+	columns := []string{}
+	if err := db.Select(&columns, query); err != nil {
+		return nil, fmt.Errorf("could not read the columns of the candles table. %w", err)
+	}
+
+	return columns, nil
+}
+
+// ensureSchema creates the candles table with every column enabled by the current options,
+// together with the unique index on its key columns, unless they already exist.
+func ensureSchema(db *sqlx.DB, cfg config) error {
+	if _, err := db.Exec(createTableStatement(db, cfg)); err != nil {
+		return fmt.Errorf("could not create candles table. %w", err)
+	}
+
+	if err := ensureIndex(db, cfg); err != nil {
+		return err
+	}
+	slog.Debug("Successfully ensured database schema.")
+
+	return nil
+}
+
+// ensureIndex creates the unique index on the key columns that -insert-ignore and -upsert rely on
+func ensureIndex(db *sqlx.DB, cfg config) error {
+	keys := keyColumns(cfg)
+	name := "candles_" + strings.Join(keys, "_")
+	if _, err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS " + name + " ON candles (" + strings.Join(keys, ", ") + ")"); err != nil {
+		return fmt.Errorf("could not create candles index. %w", err)
+	}
+
+	return nil
+}
+
+// ensureDeadLetterSchema creates the candles_errors table holding rows that failed to parse
+func ensureDeadLetterSchema(db *sqlx.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS candles_errors (
+		` + idDefinition(db) + `,
+		file TEXT NOT NULL,
+		row INTEGER NOT NULL,
+		raw TEXT NOT NULL,
+		error TEXT NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("could not create candles_errors table. %w", err)
+	}
+
+	return nil
+}
+
+// keyColumns returns the columns identifying a stored candle, (ticker, date), or (ticker, interval,
+// date) with -interval so the same date can be stored once per timeframe
+func keyColumns(cfg config) []string {
+	if cfg.interval != "" {
+		return []string{"ticker", "interval", "date"}
+	}
+
+	return []string{"ticker", "date"}
+}
+
+func createTableStatement(db *sqlx.DB, cfg config) string {
+	columns := []string{idDefinition(db)}
+	for _, c := range insertColumns(cfg) {
+		columns = append(columns, c+" "+columnDefinition(db, c))
+	}
+
+	return "CREATE TABLE IF NOT EXISTS candles (" + strings.Join(columns, ", ") + ")"
+}
+
+// isPostgres reports whether db was opened with the postgres driver, whose SQL differs from the
+// SQLite dialect of libsql
+func isPostgres(db *sqlx.DB) bool {
+	return db.DriverName() == "postgres"
+}
+
+// idDefinition returns the definition of the auto incrementing id column in the dialect of db
+func idDefinition(db *sqlx.DB) string {
+	if isPostgres(db) {
+		return "id BIGSERIAL PRIMARY KEY"
+	}
+
+	return "id INTEGER PRIMARY KEY AUTOINCREMENT"
+}
+
+// columnDefinition returns the SQL type of a column in the dialect of db. SQLite types are
+// widened to the Postgres types holding the same values.
+func columnDefinition(db *sqlx.DB, column string) string {
+	definition := columnDefinitions[column]
+	if isPostgres(db) {
+		definition = strings.Replace(definition, "REAL", "DOUBLE PRECISION", 1)
+		definition = strings.Replace(definition, "INTEGER", "BIGINT", 1)
+	}
+
+	return definition
+}
@@ -0,0 +1,144 @@
+package birdseed
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestResampleNeedsDailyCandlesWithAnInterval(t *testing.T) {
+	db := openTestDB(t)
+	if err := prepareSchema(db, testConfig(t, "-missing-table", "create")); err != nil {
+		t.Fatal(err)
+	}
+
+	err := prepareSchema(db, testConfig(t, "-resample", "weekly"))
+	if err == nil || !strings.Contains(err.Error(), "-interval daily") {
+		t.Fatalf("expected -resample to ask for daily candles seeded with -interval daily, got %v", err)
+	}
+
+	// The table is checked before the index of -upsert is created on the missing column
+	var indexes int
+	if err := db.Get(&indexes, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'candles_ticker_interval_date'"); err != nil {
+		t.Fatal(err)
+	}
+	if indexes != 0 {
+		t.Error("the index on the interval column was created although the table has no such column")
+	}
+}
+
+func TestUpsertReportsMissingColumnsBeforeCreatingItsIndex(t *testing.T) {
+	db := openTestDB(t)
+	if err := prepareSchema(db, testConfig(t, "-missing-table", "create")); err != nil {
+		t.Fatal(err)
+	}
+
+	err := prepareSchema(db, testConfig(t, "-upsert", "-interval", "1h"))
+	if err == nil || !strings.Contains(err.Error(), "missing the columns required by the current options: interval") {
+		t.Fatalf("expected the missing interval column to be reported, got %v", err)
+	}
+}
+
+func TestEnsureSchemaSeedsAFreshDatabase(t *testing.T) {
+	db := openTestDB(t)
+	dir := writeDataDir(t, map[string]string{
+		"XOM.csv": "Date,Open,High,Low,Close,Adj Close,Volume\n2019-05-01,80.3,80.9,79.6,80.1,71.2,9300000\n",
+	})
+	cfg := testConfig(t, "-data", dir, "-ensure-schema", "-with-adj-close", "-with-source")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, newReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored struct {
+		AdjClose float64 `db:"adj_close"`
+		Source   string  `db:"source_file"`
+	}
+	if err := db.Get(&stored, "SELECT adj_close, source_file FROM candles WHERE ticker = 'XOM'"); err != nil {
+		t.Fatal(err)
+	}
+	if stored.AdjClose != 71.2 || stored.Source != "XOM.csv" {
+		t.Errorf("stored adj_close %g and source_file %q, want 71.2 and XOM.csv", stored.AdjClose, stored.Source)
+	}
+
+	// The unique index is created with the table, so a second run does not duplicate the candle
+	if _, err := db.Exec("INSERT INTO candles (date, ticker, open, high, low, close, volume) VALUES ('2019-05-01', 'XOM', 1, 1, 1, 1, 1)"); err == nil {
+		t.Error("expected the unique index on (ticker, date) to reject a second candle of the day")
+	}
+
+	// Running it again on the existing table is a no-op
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Errorf("-ensure-schema failed on an existing table: %v", err)
+	}
+}
+
+func TestMissingTableErrorLeavesAFreshDatabaseUntouched(t *testing.T) {
+	db := openTestDB(t)
+
+	err := prepareSchema(db, testConfig(t, "-missing-table", "error"))
+	if err == nil || !strings.Contains(err.Error(), "the candles table does not exist") {
+		t.Fatalf("expected a missing table error, got %v", err)
+	}
+	if exists, err := tableExists(db); err != nil || exists {
+		t.Errorf("-missing-table error created the table (%v)", err)
+	}
+}
+
+func TestMissingTableCreateSeedsAFreshDatabase(t *testing.T) {
+	db := openTestDB(t)
+	dir := writeDataDir(t, map[string]string{
+		"IBM.csv": "Date,Open,High,Low,Close,Volume\n2020-08-03,123.1,123.4,121.6,122.3,3600000\n2020-08-04,122,123.7,121.8,123.2,3100000\n",
+	})
+	cfg := testConfig(t, "-data", dir, "-missing-table", "create")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, newReport()); err != nil {
+		t.Fatal(err)
+	}
+	if n := countCandles(t, db, "IBM"); n != 2 {
+		t.Errorf("stored %d candles, want 2", n)
+	}
+}
+
+func TestAdjCloseFailsUpfrontOnATableWithoutTheColumn(t *testing.T) {
+	db := openTestDB(t)
+	// A table created by an older release, before the adjusted close was stored
+	db.MustExec("CREATE TABLE candles (id INTEGER PRIMARY KEY AUTOINCREMENT, ticker TEXT NOT NULL, date TEXT NOT NULL, open REAL, high REAL, low REAL, close REAL, volume INTEGER)")
+
+	err := prepareSchema(db, testConfig(t, "-with-adj-close"))
+	want := "the candles table is missing the columns required by the current options: adj_close REAL. " +
+		"It has the columns id, ticker, date, open, high, low, close, volume"
+	if err == nil || err.Error() != want {
+		t.Fatalf("expected the missing adj_close column to be reported\ngot  %v\nwant %s", err, want)
+	}
+
+	if err := prepareSchema(db, testConfig(t)); err != nil {
+		t.Errorf("the table should still suit a seed without -with-adj-close, got %v", err)
+	}
+}
+
+func TestInsertIgnoreAddsTheIndexToAnExistingTable(t *testing.T) {
+	db := openTestDB(t)
+	// A table created by hand, without the unique index on (ticker, date)
+	db.MustExec("CREATE TABLE candles (id INTEGER PRIMARY KEY AUTOINCREMENT, ticker TEXT NOT NULL, date TEXT NOT NULL, open REAL, high REAL, low REAL, close REAL, volume INTEGER)")
+	dir := writeDataDir(t, map[string]string{
+		"PG.csv": "Date,Open,High,Low,Close,Volume\n2023-10-02,145.8,146.2,144.1,144.6,6200000\n",
+	})
+
+	cfg := testConfig(t, "-data", dir, "-insert-ignore")
+	for run := 1; run <= 2; run++ {
+		if err := prepareSchema(db, cfg); err != nil {
+			t.Fatal(err)
+		}
+		if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, newReport()); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+	}
+
+	if n := countCandles(t, db, "PG"); n != 1 {
+		t.Errorf("re-running -insert-ignore stored %d candles of PG, want 1", n)
+	}
+}
@@ -0,0 +1,107 @@
+package birdseed
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const shellHelp = `Commands:
+  latest TICKER              print the most recent candle of a ticker
+  range TICKER FROM TO       print the candles of a ticker between two dates (YYYY-MM-DD), inclusive
+  count [TICKER]             print the number of stored candles, in total or for a ticker
+  help                       print this help
+  exit                       leave the shell`
+
+// shell runs an interactive loop reading commands from r and writing the results to w, for
+// quick checks of the seeded data without a separate SQL client.
+func shell(r io.Reader, w io.Writer, db *sqlx.DB) error {
+	scanner := bufio.NewScanner(r)
+	for {
+		fmt.Fprint(w, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(w)
+			return scanner.Err()
+		}
+
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 {
+			continue
+		}
+
+		if args[0] == "exit" || args[0] == "quit" {
+			return nil
+		}
+
+		if err := runShellCommand(w, db, args); err != nil {
+			fmt.Fprintf(w, "error: %s\n", err)
+		}
+	}
+}
+
+func runShellCommand(w io.Writer, db *sqlx.DB, args []string) error {
+	switch args[0] {
+	case "help":
+		fmt.Fprintln(w, shellHelp)
+	case "latest":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: latest TICKER")
+		}
+
+		c, ok, err := latestCandle(db, args[1], "")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Fprintf(w, "no candles for '%s'\n", args[1])
+			return nil
+		}
+		fmt.Fprintf(w, "%s %s\n", c.Ticker, formatCandle(c))
+	case "range":
+		if len(args) != 4 {
+			return fmt.Errorf("usage: range TICKER FROM TO")
+		}
+
+		from, err := time.Parse(layoutISO, args[2])
+		if err != nil {
+			return fmt.Errorf("invalid FROM date '%s'", args[2])
+		}
+		to, err := time.Parse(layoutISO, args[3])
+		if err != nil {
+			return fmt.Errorf("invalid TO date '%s'", args[3])
+		}
+
+		candles, err := fetchCandles(db, args[1], from, to)
+		if err != nil {
+			return err
+		}
+		for _, c := range candles {
+			fmt.Fprintf(w, "%s %s\n", c.Ticker, formatCandle(c))
+		}
+		fmt.Fprintf(w, "%d candles\n", len(candles))
+	case "count":
+		if len(args) > 2 {
+			return fmt.Errorf("usage: count [TICKER]")
+		}
+
+		var count int64
+		var err error
+		if len(args) == 2 {
+			err = db.Get(&count, db.Rebind("SELECT COUNT(1) FROM candles WHERE ticker = ?"), args[1])
+		} else {
+			err = db.Get(&count, "SELECT COUNT(1) FROM candles")
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, count)
+	default:
+		return fmt.Errorf("unknown command '%s', type help for a list of commands", args[0])
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package birdseed
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestShellRunsScriptedCommands(t *testing.T) {
+	db := openTestDB(t)
+	cfg := testConfig(t, "-missing-table", "create")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := bulkInsert(context.Background(), db, []Candle{
+		{Ticker: "AAPL", Date: day("2024-01-02"), Open: 187.2, High: 188.4, Low: 183.9, Close: 185.6, Volume: 82500000},
+		{Ticker: "AAPL", Date: day("2024-01-03"), Open: 184.2, High: 185.9, Low: 183.4, Close: 184.3, Volume: 58400000},
+		{Ticker: "AAPL", Date: day("2024-02-01"), Open: 183.9, High: 186.9, Low: 183.8, Close: 186.9, Volume: 64900000},
+		{Ticker: "MSFT", Date: day("2024-01-02"), Open: 373.9, High: 375.9, Low: 366.8, Close: 370.9, Volume: 25300000},
+	}, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	script := strings.Join([]string{
+		"latest AAPL",
+		"",
+		"range AAPL 2024-01-01 2024-01-31",
+		"count",
+		"count MSFT",
+		"latest TSLA",
+		"range AAPL yesterday today",
+		"drop table candles",
+		"exit",
+		"count",
+	}, "\n")
+
+	var out bytes.Buffer
+	if err := shell(strings.NewReader(script), &out, db); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "> AAPL 2024-02-01 O=183.9 H=186.9 L=183.8 C=186.9 V=64900000\n" +
+		"> > AAPL 2024-01-02 O=187.2 H=188.4 L=183.9 C=185.6 V=82500000\n" +
+		"AAPL 2024-01-03 O=184.2 H=185.9 L=183.4 C=184.3 V=58400000\n" +
+		"2 candles\n" +
+		"> 4\n" +
+		"> 1\n" +
+		"> no candles for 'TSLA'\n" +
+		"> error: invalid FROM date 'yesterday'\n" +
+		"> error: unknown command 'drop', type help for a list of commands\n" +
+		"> "
+	if out.String() != want {
+		t.Errorf("the shell printed\n%s\nwant\n%s", out.String(), want)
+	}
+}
@@ -0,0 +1,75 @@
+package birdseed
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// source lists and opens the csv files that candles are read from
+type source interface {
+	// files returns the names of all files in the source, in the order they should be read
+	files() ([]string, error)
+	// open opens the named file for reading
+	open(name string) (io.ReadCloser, error)
+}
+
+func newSource(cfg config) (source, error) {
+	if cfg.s3 != "" {
+		return newS3Source(cfg.s3, cfg.s3PathStyle)
+	}
+
+	if isURL(cfg.dataDir) {
+		return newHTTPSource(cfg.dataDir, cfg.urlTicker, cfg.httpTimeout)
+	}
+
+	if cfg.dataDir == "-" {
+		return stdinSource{ticker: cfg.stdinTicker, in: os.Stdin}, nil
+	}
+
+	return dirSource{dir: cfg.dataDir}, nil
+}
+
+// stdinSource reads a single csv stream of one ticker from stdin, e.g. at the end of a pipeline
+type stdinSource struct {
+	ticker string
+	in     io.Reader
+}
+
+// files names the stream after its ticker, so the ticker is derived from it as from a ticker.csv file
+func (s stdinSource) files() ([]string, error) {
+	return []string{s.ticker + ".csv"}, nil
+}
+
+func (s stdinSource) open(name string) (io.ReadCloser, error) {
+	return io.NopCloser(s.in), nil
+}
+
+// dirSource reads the files of a local directory
+type dirSource struct {
+	dir string
+}
+
+func (s dirSource) files() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("the data directory '%s' does not exist, set it with -data", s.dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read the data directory '%s'. %w", s.dir, err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+
+	return names, nil
+}
+
+func (s dirSource) open(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.dir, name))
+}
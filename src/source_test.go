@@ -0,0 +1,39 @@
+package birdseed
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestStdinTickerSeedsTheStreamUnderThatTicker(t *testing.T) {
+	cfg := testConfig(t, "-stdin-ticker", "brk.b", "-missing-table", "create")
+	if cfg.dataDir != "-" {
+		t.Fatalf("-stdin-ticker alone reads -data %q, want -", cfg.dataDir)
+	}
+
+	src, err := newSource(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin, ok := src.(stdinSource)
+	if !ok {
+		t.Fatalf("-stdin-ticker opened a %T", src)
+	}
+	stdin.in = strings.NewReader("Date,Open,High,Low,Close,Volume\n2024-08-01,440.2,442.9,437.5,441.8,3900000\n2024-08-02,439,440.7,431.2,432.5,4600000\n")
+
+	db := openTestDB(t)
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := seedDatabase(context.Background(), db, stdin, cfg, newReport()); err != nil {
+		t.Fatal(err)
+	}
+	if n := countCandles(t, db, "BRK.B"); n != 2 {
+		t.Errorf("the stream seeded %d candles of BRK.B, want 2", n)
+	}
+
+	if _, err := parseFlags([]string{"-data", "-"}); err == nil || !strings.Contains(err.Error(), "-stdin-ticker") {
+		t.Errorf("expected -data - without -stdin-ticker to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package birdseed
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+)
+
+// writeSQLite seeds the candles into a new standalone SQLite file at path, replacing any
+// existing file, and gzips it when -gzip-db is set.
+func writeSQLite(path string, candles []Candle, cfg config) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	db, err := sqlx.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := ensureSchema(db, cfg); err != nil {
+		return err
+	}
+
+	if len(candles) > 0 {
+		if err := bulkInsert(context.Background(), db, candles, cfg); err != nil {
+			return err
+		}
+	}
+
+	if err := db.Close(); err != nil {
+		return err
+	}
+	slog.Info("Successfully wrote candles.", "candles", len(candles), "file", path)
+
+	if cfg.gzipDB {
+		return gzipFile(path, cfg.gzipDBRemove)
+	}
+
+	return nil
+}
+
+// gzipFile compresses path into path.gz, removing the uncompressed file if remove is set
+func gzipFile(path string, remove bool) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		return fmt.Errorf("could not gzip '%s'. %w", path, err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("could not gzip '%s'. %w", path, err)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	slog.Info("Successfully compressed file.", "file", path, "to", path+".gz")
+
+	if remove {
+		in.Close()
+		return os.Remove(path)
+	}
+
+	return nil
+}
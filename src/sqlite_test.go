@@ -0,0 +1,56 @@
+package birdseed
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestGzipDBDecompressesToAValidSQLiteFile(t *testing.T) {
+	dir := writeDataDir(t, map[string]string{
+		"BTC-USD.csv": "Date,Open,High,Low,Close,Volume\n2024-03-09,68300,68600,67900,68500,19000\n2024-03-10,68500,70000,68200,69000,26000\n",
+	})
+	out := filepath.Join(t.TempDir(), "candles.db")
+	if err := writeOutput(dirSource{dir: dir}, testConfig(t, "-data", dir, "-output", "sqlite", "-out", out, "-gzip-db", "-gzip-db-remove")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("the uncompressed file should have been removed, got %v", err)
+	}
+
+	f, err := os.Open(out + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := filepath.Join(t.TempDir(), "restored.db")
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(restored, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sqlx.Open("sqlite", restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var integrity string
+	if err := db.Get(&integrity, "PRAGMA integrity_check"); err != nil || integrity != "ok" {
+		t.Fatalf("the decompressed file is not a valid SQLite database: %s %v", integrity, err)
+	}
+	if n := countCandles(t, db, "BTC-USD"); n != 2 {
+		t.Errorf("the decompressed database holds %d candles, want 2", n)
+	}
+}
@@ -0,0 +1,33 @@
+package birdseed
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// datasetSummary is a one glance view of the stored candles
+type datasetSummary struct {
+	Tickers int            `db:"tickers"`
+	Candles int            `db:"candles"`
+	First   sql.NullString `db:"first"`
+	Last    sql.NullString `db:"last"`
+}
+
+// summarize prints how many tickers and candles are stored and the range of dates they cover
+func summarize(w io.Writer, db *sqlx.DB) error {
+	s := datasetSummary{}
+	err := db.Get(&s, "SELECT COUNT(DISTINCT ticker) AS tickers, COUNT(*) AS candles, MIN(date) AS first, MAX(date) AS last FROM candles")
+	if err != nil {
+		return fmt.Errorf("could not summarize candles. %w", err)
+	}
+
+	fmt.Fprintf(w, "Tickers: %d\nCandles: %d\n", s.Tickers, s.Candles)
+	if s.First.Valid {
+		fmt.Fprintf(w, "First date: %s\nLast date: %s\n", s.First.String, s.Last.String)
+	}
+
+	return nil
+}
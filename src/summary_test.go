@@ -0,0 +1,44 @@
+package birdseed
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestSummarizeCountsTheSeededTickersAndDates(t *testing.T) {
+	db := openTestDB(t)
+	dir := writeDataDir(t, map[string]string{
+		"XOM.csv": "Date,Open,High,Low,Close,Adj Close,Volume\n" +
+			"2019-07-01,76.1,76.9,75.8,76.5,70.2,9800000\n" +
+			"2019-07-02,76.4,76.6,75.1,75.3,69.1,8600000\n",
+		"CVX.csv": "Date,Open,High,Low,Close,Adj Close,Volume\n" +
+			"2019-06-28,123.9,124.8,123.1,124.4,112.6,7200000\n" +
+			"2019-07-01,125.2,126.6,124.9,125.8,113.9,6900000\n" +
+			"2019-07-03,126,127.3,125.6,127.1,115,4100000\n",
+	})
+	cfg := testConfig(t, "-data", dir, "-missing-table", "create")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := summarize(&out, db); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Tickers: 0\nCandles: 0\n"; out.String() != want {
+		t.Errorf("the summary of an empty table is\n%s\nwant\n%s", out.String(), want)
+	}
+
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, newReport()); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := summarize(&out, db); err != nil {
+		t.Fatal(err)
+	}
+	want := "Tickers: 2\nCandles: 5\nFirst date: 2019-06-28\nLast date: 2019-07-03\n"
+	if out.String() != want {
+		t.Errorf("summary is\n%s\nwant\n%s", out.String(), want)
+	}
+}
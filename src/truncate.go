@@ -0,0 +1,107 @@
+package birdseed
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// confirmTruncate asks on out to type yes before -truncate deletes any stored candles. Without a
+// terminal to answer on, e.g. in a scheduled run or when the data is read from stdin, the run
+// has to be confirmed with -yes instead.
+func confirmTruncate(in io.Reader, out io.Writer, cfg config) error {
+	refused := fmt.Errorf("-truncate deletes the stored candles of every seeded ticker, confirm it with -yes")
+	if cfg.dataDir == "-" {
+		return refused
+	}
+	if f, ok := in.(*os.File); ok {
+		info, err := f.Stat()
+		if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+			return refused
+		}
+	}
+
+	fmt.Fprintf(out, "This deletes the stored candles of every ticker in '%s' before seeding it. Type yes to continue: ", cfg.dataDir)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if strings.TrimSpace(answer) != "yes" {
+		return fmt.Errorf("-truncate was not confirmed")
+	}
+
+	return nil
+}
+
+// replaceCandles deletes the stored candles of the ticker of a parsed file, within the -interval
+// if any, and inserts the candles of the file in the same transaction, so readers see either the
+// old or the new candles of the ticker and a failed insert keeps the old ones. The whole ticker
+// is a single transaction regardless of -tx-size.
+func replaceCandles(ctx context.Context, db *sqlx.DB, candles []Candle, cfg config) error {
+	ticker := candles[0].Ticker
+	var values []interface{}
+	for _, c := range candles {
+		values = appendCandleValues(values, c, cfg)
+	}
+
+	var deleted int64
+	err := withRetries(ctx, cfg, func() error {
+		var err error
+		deleted, err = replaceTx(ctx, db, cfg, ticker, values)
+		return err
+	}, "ticker", ticker)
+	if err != nil {
+		return fmt.Errorf("could not replace candles of ticker '%s'. %w", ticker, err)
+	}
+	slog.Info("Replaced stored candles.", "ticker", ticker, "deleted", deleted, "inserted", len(candles))
+
+	return nil
+}
+
+// replaceTx deletes the stored candles of a ticker and inserts the values in batches of -batch
+// candles in one transaction, returning the number of deleted rows
+func replaceTx(ctx context.Context, db *sqlx.DB, cfg config, ticker string, values []interface{}) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	scope, args := intervalClause(cfg.interval)
+	res, err := tx.ExecContext(ctx, db.Rebind("DELETE FROM candles WHERE ticker = ?"+scope), append([]any{ticker}, args...)...)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	paramLength := len(insertColumns(cfg))
+	size := cfg.batch * paramLength
+	full := len(values) / size
+	if full > 0 {
+		stmt, err := tx.PrepareContext(ctx, insertNCandlesStatement(db, cfg, cfg.batch))
+		if err != nil {
+			return 0, err
+		}
+		for i := 0; i < full; i++ {
+			if _, err := stmt.ExecContext(ctx, values[i*size:(i+1)*size]...); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if rest := values[full*size:]; len(rest) > 0 {
+		if _, err := tx.ExecContext(ctx, insertNCandlesStatement(db, cfg, len(rest)/paramLength), rest...); err != nil {
+			return 0, err
+		}
+	}
+
+	return deleted, tx.Commit()
+}
@@ -0,0 +1,109 @@
+package birdseed
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTruncateKeepsTheOldCandlesWhenAnInsertFails(t *testing.T) {
+	db := openTestDB(t)
+	cfg := testConfig(t, "-missing-table", "create")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := bulkInsert(context.Background(), db, []Candle{
+		{Ticker: "ORCL", Date: day("2023-06-12"), Open: 110.1, High: 116.3, Low: 109.8, Close: 116, Volume: 21000000},
+		{Ticker: "ORCL", Date: day("2023-06-13"), Open: 118.2, High: 127.5, Low: 117.9, Close: 126.1, Volume: 42000000},
+	}, cfg); err != nil {
+		t.Fatal(err)
+	}
+	// The second insert of the replacement file is refused, after its delete and first insert ran
+	db.MustExec("CREATE TRIGGER refuse BEFORE INSERT ON candles WHEN NEW.date = '2023-06-13' AND NEW.close = 125 BEGIN SELECT RAISE(ABORT, 'refused'); END")
+
+	dir := writeDataDir(t, map[string]string{
+		"ORCL.csv": "Date,Open,High,Low,Close,Volume\n2023-06-12,110.1,116.3,109.8,115.5,21000000\n2023-06-13,118.2,127.5,117.9,125,42000000\n",
+	})
+	err := seedDatabase(context.Background(), db, dirSource{dir: dir}, testConfig(t, "-data", dir, "-truncate", "-yes", "-batch", "1", "-max-retries", "0"), newReport())
+	if err == nil || !strings.Contains(err.Error(), "refused") {
+		t.Fatalf("expected the refused insert to fail the seed, got %v", err)
+	}
+
+	closes := []float64{}
+	if err := db.Select(&closes, "SELECT close FROM candles WHERE ticker = 'ORCL' ORDER BY date"); err != nil {
+		t.Fatal(err)
+	}
+	if len(closes) != 2 || closes[0] != 116 || closes[1] != 126.1 {
+		t.Errorf("the failed replace left the closes %v, want the old 116 and 126.1", closes)
+	}
+}
+
+func TestTruncateReplacesOnlyItsIntervalAndLogsTheDeletedRows(t *testing.T) {
+	db := openTestDB(t)
+	daily := testConfig(t, "-missing-table", "create", "-interval", "daily")
+	if err := prepareSchema(db, daily); err != nil {
+		t.Fatal(err)
+	}
+	stored := []Candle{}
+	for _, d := range []string{"2024-05-06", "2024-05-07", "2024-05-08"} {
+		stored = append(stored, Candle{Ticker: "CAT", Date: day(d), Open: 340, High: 345, Low: 338, Close: 343, Volume: 2500000, Interval: "daily"})
+	}
+	if err := bulkInsert(context.Background(), db, stored, daily); err != nil {
+		t.Fatal(err)
+	}
+	if err := bulkInsert(context.Background(), db, []Candle{
+		{Ticker: "CAT", Date: day("2024-05-06"), Open: 340, High: 352, Low: 336, Close: 350, Volume: 12000000, Interval: "weekly"},
+	}, testConfig(t, "-interval", "weekly")); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := writeDataDir(t, map[string]string{
+		"CAT.csv": "Date,Open,High,Low,Close,Volume\n2024-05-09,343,349.6,342.1,348.8,2700000\n2024-05-10,349,351.2,346.4,350.2,2300000\n",
+	})
+	logs := captureLogs(t)
+	if err := seedDatabase(context.Background(), db, dirSource{dir: dir}, testConfig(t, "-data", dir, "-truncate", "-yes", "-interval", "daily"), newReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	kept := []string{}
+	if err := db.Select(&kept, "SELECT interval || ' ' || date FROM candles ORDER BY interval, date"); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(kept, ","); got != "daily 2024-05-09,daily 2024-05-10,weekly 2024-05-06" {
+		t.Errorf("stored %s, want the new daily candles beside the untouched weekly one", got)
+	}
+	if !strings.Contains(logs.String(), `msg="Replaced stored candles." ticker=CAT deleted=3 inserted=2`) {
+		t.Errorf("expected the 3 deleted daily rows to be logged, got\n%s", logs.String())
+	}
+}
+
+func TestConfirmTruncate(t *testing.T) {
+	var prompt strings.Builder
+	if err := confirmTruncate(strings.NewReader("yes\n"), &prompt, testConfig(t, "-data", "prices")); err != nil {
+		t.Errorf("typing yes was refused: %v", err)
+	}
+	if !strings.Contains(prompt.String(), "every ticker in 'prices'") {
+		t.Errorf("the prompt does not name the data directory: %q", prompt.String())
+	}
+	if err := confirmTruncate(strings.NewReader("y\n"), &prompt, testConfig(t, "-data", "prices")); err == nil {
+		t.Error("an answer other than yes was accepted")
+	}
+
+	// The csv data arrives on stdin, so there is nobody to answer
+	if err := confirmTruncate(strings.NewReader("yes\n"), &prompt, testConfig(t, "-data", "-", "-stdin-ticker", "AAPL")); err == nil || !strings.Contains(err.Error(), "-yes") {
+		t.Errorf("expected -data - to require -yes, got %v", err)
+	}
+
+	// A scheduled run reads from a file or pipe rather than a terminal
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	w.WriteString("yes\n")
+	w.Close()
+	if err := confirmTruncate(r, &prompt, testConfig(t, "-data", "prices")); err == nil || !strings.Contains(err.Error(), "-yes") {
+		t.Errorf("expected stdin that is not a terminal to require -yes, got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package birdseed
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// validateFiles parses every file of the source up front for -validate-first and returns the
+// number of files and rows that failed, logging each failure. Unlike seeding it does not stop at
+// the first bad row, so every problem in the directory is reported at once.
+func validateFiles(src source, cfg config) (int, error) {
+	// Collect the bad rows of each file rather than stopping at the first one
+	cfg.deadLetter = true
+
+	files, err := src.files()
+	if err != nil {
+		return 0, err
+	}
+
+	// Only the files a seed would read are validated, e.g. none before -start-ticker
+	files = selectFiles(files, cfg)
+
+	done := make(chan struct{})
+	defer close(done)
+
+	failures := 0
+	for p := range parseFiles(src, files, cfg, cfg.parseWorkers, done) {
+		if p.err != nil {
+			slog.Warn("Validation failed.", "file", p.file, "err", p.err)
+			failures++
+		}
+
+		for _, b := range p.bad {
+			slog.Warn("Validation failed.", "err", b.err)
+			failures++
+		}
+	}
+
+	return failures, nil
+}
+
+// validateFirst runs validateFiles and fails when anything did not parse, before the database is written to
+func validateFirst(src source, cfg config) error {
+	failures, err := validateFiles(src, cfg)
+	if err != nil {
+		return fmt.Errorf("could not validate csv files. %w", err)
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("validation found %d errors, nothing was seeded", failures)
+	}
+	slog.Info("Successfully validated all files.")
+
+	return nil
+}
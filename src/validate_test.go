@@ -0,0 +1,58 @@
+package birdseed
+
+import (
+	"context"
+	"testing"
+)
+
+func TestValidateFilesSkipsTickersBeforeTheStartTicker(t *testing.T) {
+	dir := writeDataDir(t, map[string]string{
+		// Fails to parse, but a resumed seed never reads it
+		"AAA.csv": "Date,Close/Last,Volume,Open,High,Low\n01/02/2024,not a price,100,$9,$11,$8\n",
+		"BBB.csv": "Date,Close/Last,Volume,Open,High,Low\n01/02/2024,$10,100,$9,$11,$8\n",
+		"CCC.csv": "Date,Close/Last,Volume,Open,High,Low\n01/02/2024,$10,oops,$9,$11,$8\n",
+	})
+
+	failures, err := validateFiles(dirSource{dir: dir}, testConfig(t, "-data", dir, "-start-ticker", "bbb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failures != 1 {
+		t.Errorf("found %d failures, want only the one of CCC", failures)
+	}
+
+	failures, err = validateFiles(dirSource{dir: dir}, testConfig(t, "-data", dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failures != 2 {
+		t.Errorf("found %d failures without -start-ticker, want 2", failures)
+	}
+}
+
+func TestValidateFirstSeedsNothingWhenOneFileIsInvalid(t *testing.T) {
+	db := openTestDB(t)
+	dir := writeDataDir(t, map[string]string{
+		"ABBV.csv": "Date,Close/Last,Volume,Open,High,Low\n03/04/2024,$179.9,5400000,$177.2,$180.6,$176.8\n",
+		"MRK.csv":  "Date,Close/Last,Volume,Open,High,Low\n03/04/2024,$127.4,7200000,$126.9,$128.1,$126.3\n",
+		// Sorted last, so a plain seed would already have stored the other two. The high is below the low.
+		"ZTS.csv": "Date,Close/Last,Volume,Open,High,Low\n03/04/2024,$190.2,1900000,$189.5,$185.1,$191.7\n",
+	})
+	cfg := testConfig(t, "-data", dir, "-missing-table", "create", "-validate-first")
+	if err := prepareSchema(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	err := seedDatabase(context.Background(), db, dirSource{dir: dir}, cfg, newReport())
+	if err == nil || err.Error() != "validation found 1 errors, nothing was seeded" {
+		t.Fatalf("expected the invalid file to stop the seed, got %v", err)
+	}
+
+	var stored int
+	if err := db.Get(&stored, "SELECT COUNT(*) FROM candles"); err != nil {
+		t.Fatal(err)
+	}
+	if stored != 0 {
+		t.Errorf("%d candles were seeded although a file is invalid", stored)
+	}
+}
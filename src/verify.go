@@ -0,0 +1,175 @@
+package birdseed
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// verifySamplesShown is the number of problems of each kind printed per ticker by -verify
+const verifySamplesShown = 5
+
+// tickerCheck holds the problems -verify found in the stored candles of a ticker and interval
+type tickerCheck struct {
+	interval   string
+	candles    int
+	first      string
+	last       string
+	duplicates []string
+	outOfOrder []string
+	missing    []string
+	invalid    []string
+}
+
+func (t tickerCheck) problems() int {
+	return len(t.duplicates) + len(t.outOfOrder) + len(t.missing) + len(t.invalid)
+}
+
+// verifyTickers checks the stored candles of every -verify ticker, optionally limited to the days
+// from -from up to and including -to and to an -interval, and prints a summary per ticker. It
+// fails if any ticker has a problem, so it can gate a pipeline.
+func verifyTickers(w io.Writer, db *sqlx.DB, cfg config) error {
+	failed := 0
+	tickers := strings.Split(cfg.verify, ",")
+	for _, ticker := range tickers {
+		ticker = strings.TrimSpace(ticker)
+		candles, err := storedRange(db, ticker, cfg.interval, cfg.from, cfg.to)
+		if err != nil {
+			return err
+		}
+
+		// Each interval is its own series, so e.g. a weekly candle is not a duplicate of the
+		// daily candle of its monday
+		checks := []tickerCheck{}
+		for _, series := range byInterval(candles) {
+			checks = append(checks, verifyCandles(series, cfg.verifyWeekends))
+		}
+		if len(checks) == 0 {
+			checks = append(checks, tickerCheck{})
+		}
+
+		problems := false
+		for _, check := range checks {
+			printCheck(w, ticker, check)
+			problems = problems || check.candles == 0 || check.problems() > 0
+		}
+		if problems {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("-verify found problems in %d of %d tickers", failed, len(tickers))
+	}
+
+	return nil
+}
+
+// byInterval splits date ordered candles into a date ordered series per interval, in the order
+// the intervals first appear
+func byInterval(candles []Candle) [][]Candle {
+	index := map[string]int{}
+	series := [][]Candle{}
+	for _, c := range candles {
+		i, ok := index[c.Interval]
+		if !ok {
+			i = len(series)
+			index[c.Interval] = i
+			series = append(series, nil)
+		}
+		series[i] = append(series[i], c)
+	}
+
+	return series
+}
+
+// verifyCandles checks the stored candles of a ticker in a single interval, ordered by date, for
+// duplicate dates, rows stored after a later date, missing business days and candles that fail
+// validate. Days are only checked to be missing between daily candles, and weekends only with
+// weekends set.
+func verifyCandles(candles []Candle, weekends bool) tickerCheck {
+	check := tickerCheck{candles: len(candles)}
+	if len(candles) == 0 {
+		return check
+	}
+	check.interval = candles[0].Interval
+	check.first, check.last = candles[0].storedDate(), candles[len(candles)-1].storedDate()
+	daily := check.interval == "" || check.interval == "daily"
+
+	for i, c := range candles {
+		if err := validate(c); err != nil {
+			check.invalid = append(check.invalid, err.Error())
+		}
+		if i == 0 {
+			continue
+		}
+
+		prev := candles[i-1]
+		if c.storedDate() == prev.storedDate() {
+			check.duplicates = append(check.duplicates, c.storedDate())
+			continue
+		}
+		if !daily || c.Intraday || prev.Intraday {
+			continue
+		}
+		for day := prev.Date.AddDate(0, 0, 1); day.Before(c.Date); day = day.AddDate(0, 0, 1) {
+			if weekends || (day.Weekday() != time.Saturday && day.Weekday() != time.Sunday) {
+				check.missing = append(check.missing, day.Format(layoutISO))
+			}
+		}
+	}
+
+	// Rows are stored in the order they were inserted, so an id above that of a later date means
+	// the row was inserted after it, e.g. by a backfill or an append of an unsorted file
+	byID := append([]Candle(nil), candles...)
+	sort.SliceStable(byID, func(i, j int) bool { return byID[i].ID < byID[j].ID })
+	for i := 1; i < len(byID); i++ {
+		if byID[i].storedDate() < byID[i-1].storedDate() {
+			check.outOfOrder = append(check.outOfOrder, fmt.Sprintf("%s after %s", byID[i].storedDate(), byID[i-1].storedDate()))
+		}
+	}
+
+	return check
+}
+
+func printCheck(w io.Writer, ticker string, check tickerCheck) {
+	if check.interval != "" {
+		ticker += " " + check.interval
+	}
+	if check.candles == 0 {
+		fmt.Fprintf(w, "%s: no stored candles\n", ticker)
+		return
+	}
+
+	status := "ok"
+	if n := check.problems(); n > 0 {
+		status = fmt.Sprintf("%d problems", n)
+	}
+	fmt.Fprintf(w, "%s: %s, %d candles from %s to %s\n", ticker, status, check.candles, check.first, check.last)
+
+	for _, kind := range []struct {
+		name   string
+		values []string
+	}{
+		{"duplicate dates", check.duplicates},
+		{"out of order rows", check.outOfOrder},
+		{"missing days", check.missing},
+		{"invalid candles", check.invalid},
+	} {
+		if len(kind.values) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "  %s: %d\n", kind.name, len(kind.values))
+		for i, v := range kind.values {
+			if i == verifySamplesShown {
+				fmt.Fprintf(w, "    ...\n")
+				break
+			}
+			fmt.Fprintf(w, "    %s\n", v)
+		}
+	}
+}
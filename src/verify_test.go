@@ -0,0 +1,74 @@
+package birdseed
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func day(s string) time.Time {
+	d, err := time.Parse(layoutISO, s)
+	if err != nil {
+		panic(err)
+	}
+
+	return d
+}
+
+func TestVerifyChecksEachIntervalAsItsOwnSeries(t *testing.T) {
+	db := openTestDB(t)
+	daily := testConfig(t, "-missing-table", "create", "-interval", "daily")
+	if err := prepareSchema(db, daily); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two weeks of daily candles, and the same two weeks as weekly candles dated on their monday
+	candles := []Candle{}
+	for d := day("2024-01-01"); d.Before(day("2024-01-13")); d = d.AddDate(0, 0, 1) {
+		if d.Weekday() != time.Saturday && d.Weekday() != time.Sunday {
+			candles = append(candles, Candle{Ticker: "AAA", Date: d, Open: 1, High: 2, Low: 1, Close: 2, Interval: "daily"})
+		}
+	}
+	if err := bulkInsert(context.Background(), db, candles, daily); err != nil {
+		t.Fatal(err)
+	}
+	weekly := testConfig(t, "-interval", "weekly")
+	if err := bulkInsert(context.Background(), db, []Candle{
+		{Ticker: "AAA", Date: day("2024-01-01"), Open: 1, High: 2, Low: 1, Close: 2, Interval: "weekly"},
+		{Ticker: "AAA", Date: day("2024-01-08"), Open: 1, High: 2, Low: 1, Close: 2, Interval: "weekly"},
+	}, weekly); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := verifyTickers(&out, db, testConfig(t, "-verify", "AAA")); err != nil {
+		t.Fatalf("verify failed: %v\n%s", err, out.String())
+	}
+	for _, want := range []string{
+		"AAA daily: ok, 10 candles from 2024-01-01 to 2024-01-12",
+		"AAA weekly: ok, 2 candles from 2024-01-01 to 2024-01-08",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output is missing %q, got\n%s", want, out.String())
+		}
+	}
+}
+
+func TestVerifyReportsMissingBusinessDays(t *testing.T) {
+	candles := []Candle{
+		{Ticker: "AAA", Date: day("2024-01-04"), Open: 1, High: 2, Low: 1, Close: 2},
+		{Ticker: "AAA", Date: day("2024-01-10"), Open: 1, High: 2, Low: 1, Close: 2},
+	}
+
+	check := verifyCandles(candles, false)
+	if got, want := strings.Join(check.missing, ","), "2024-01-05,2024-01-08,2024-01-09"; got != want {
+		t.Errorf("missing days are %s, want %s", got, want)
+	}
+
+	check = verifyCandles(candles, true)
+	if len(check.missing) != 5 {
+		t.Errorf("with weekends %d days are missing, want 5: %v", len(check.missing), check.missing)
+	}
+}
@@ -0,0 +1,46 @@
+package birdseed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// postReport sends the summary to -webhook-url. The seed has already finished at this point, so
+// an unreachable webhook is logged rather than failing the run.
+func postReport(cfg config, summary reportSummary) {
+	if err := postJSON(cfg, summary); err != nil {
+		slog.Warn("Could not post report to webhook.", "url", cfg.webhookURL, "err", err)
+	}
+}
+
+func postJSON(cfg config, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("could not encode report. %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status '%s'", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package birdseed
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPostReportSendsTheSummary(t *testing.T) {
+	posted := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		posted <- r
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	rep := newReport()
+	rep.files = 3
+	rep.recordCandles([]Candle{{Ticker: "AMD"}, {Ticker: "AMD"}, {Ticker: "NVDA"}})
+	rep.skipped["INTC"] = true
+
+	postReport(testConfig(t, "-webhook-url", srv.URL), rep.summary(errors.New("could not seed data. disk full")))
+
+	r := <-posted
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("got a %s request of %s", r.Method, r.Header.Get("Content-Type"))
+	}
+	var summary map[string]any
+	if err := json.Unmarshal(<-bodies, &summary); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]any{
+		"success": false,
+		"error":   "could not seed data. disk full",
+		"files":   3.0,
+		"candles": 3.0,
+	} {
+		if summary[key] != want {
+			t.Errorf("posted %s=%v, want %v", key, summary[key], want)
+		}
+	}
+	if tickers, _ := json.Marshal(summary["tickers"]); string(tickers) != `{"AMD":2,"NVDA":1}` {
+		t.Errorf("posted tickers=%s", tickers)
+	}
+	if skipped, _ := json.Marshal(summary["skipped"]); string(skipped) != `["INTC"]` {
+		t.Errorf("posted skipped=%s", skipped)
+	}
+}
+
+func TestPostReportOnlyLogsAnUnreachableWebhook(t *testing.T) {
+	// Never answers within the timeout
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	logs := captureLogs(t)
+	start := time.Now()
+	postReport(testConfig(t, "-webhook-url", srv.URL, "-webhook-timeout", "50ms"), newReport().summary(nil))
+
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("the webhook timeout was not honored, took %s", took)
+	}
+	if !strings.Contains(logs.String(), "Could not post report to webhook.") {
+		t.Errorf("expected the failure to be logged, got\n%s", logs.String())
+	}
+}